@@ -45,6 +45,7 @@ func runGateway(args []string, logger *slog.Logger) error {
 	fs := flag.NewFlagSet("anthropic-gateway", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	cfgPath := fs.String("c", "", "path to yaml config file")
+	watch := fs.Bool("watch", false, "reload config when the file changes")
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("parse args: %w", err)
 	}
@@ -59,21 +60,31 @@ func runGateway(args []string, logger *slog.Logger) error {
 	}
 
 	ad := adapter.NewAnthropicCompatibleAdapter()
-	service := gateway.NewService(cfg, ad, logger)
+	service, err := gateway.NewService(cfg, ad, logger)
+	if err != nil {
+		return fmt.Errorf("init gateway: %w", err)
+	}
+	defer func() {
+		if err := service.Close(); err != nil {
+			logger.Error("failed to close gateway", "error", err)
+		}
+	}()
 	server := httpserver.New(cfg.Listen, logger, service)
 
 	errCh := make(chan error, 1)
 	go func() {
-		logger.Info("gateway starting", "listen", cfg.Listen)
+		logger.Info("gateway starting", "listen", cfg.Listen.Addresses())
 		errCh <- server.ListenAndServe()
 	}()
 
 	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	go watchReloads(sigCtx, *cfgPath, *watch, service, logger)
+
 	select {
 	case <-sigCtx.Done():
-		logger.Info("shutdown signal received")
+		stop()
 	case err := <-errCh:
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			return fmt.Errorf("server exited unexpectedly: %w", err)
@@ -81,8 +92,20 @@ func runGateway(args []string, logger *slog.Logger) error {
 		return nil
 	}
 
-	if err := server.Shutdown(context.Background()); err != nil {
-		return fmt.Errorf("graceful shutdown failed: %w", err)
+	policy := service.Config().ShutdownPolicy()
+	logger.Info("shutdown signal received, draining", "drain_timeout_ms", policy.DrainTimeout.Milliseconds())
+	drainCtx, cancel := context.WithTimeout(context.Background(), policy.DrainTimeout)
+	open := service.Drain(drainCtx)
+	cancel()
+	if open > 0 {
+		logger.Warn("drain timeout reached, closing open streams", "open_streams", open)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), policy.GraceTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("graceful shutdown incomplete, closing connections", "error", err, "open_streams", service.OpenStreams())
+		_ = server.Close()
 	}
 	logger.Info("gateway stopped")
 	return nil
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/gateway"
+)
+
+const configWatchInterval = 2 * time.Second
+
+func watchReloads(ctx context.Context, path string, watch bool, service *gateway.Service, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	lastSum := fileSum(path)
+	if watch {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info("reload signal received", "path", path)
+			reloadConfig(path, service, logger)
+			lastSum = fileSum(path)
+		case <-tick:
+			sum := fileSum(path)
+			if sum == nil || bytes.Equal(sum, lastSum) {
+				continue
+			}
+			lastSum = sum
+			logger.Info("config file changed", "path", path)
+			reloadConfig(path, service, logger)
+		}
+	}
+}
+
+func reloadConfig(path string, service *gateway.Service, logger *slog.Logger) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		logger.Error("config reload failed, keeping current config", "error", err, "path", path)
+		return
+	}
+
+	restart, err := service.Reload(cfg)
+	if err != nil {
+		logger.Error("config reload failed, keeping current config", "error", err, "path", path)
+		return
+	}
+	logger.Info("config reloaded", "path", path, "models", len(cfg.ModelList), "keys", len(cfg.Keys))
+	if len(restart) > 0 {
+		logger.Warn("config changes require a restart to take effect", "settings", strings.Join(restart, ","))
+	}
+}
+
+func fileSum(path string) []byte {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
@@ -1,15 +1,36 @@
 package adapter
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
 	"anthropic-gateway/internal/config"
 	"anthropic-gateway/internal/models"
 )
 
+var (
+	ErrUnsupportedPath = errors.New("path is not supported by upstream provider")
+	ErrInvalidRequest  = errors.New("invalid request")
+	ErrUpstreamAuth    = errors.New("upstream authorization failed")
+)
+
 type Adapter interface {
 	BuildUpstreamURL(apiBase, upstreamPath, rawQuery string) (string, error)
 	ApplyAuthHeaders(headers http.Header, params config.UpstreamParams)
 	BuildModelsResponse(cfg *config.Config) models.ListResponse
 	NormalizeUpstreamError(statusCode int, upstreamBody []byte, requestID string) []byte
+	TranslateRequest(upstreamPath string, payload map[string]any) (UpstreamRequest, error)
+	TranslateResponse(body []byte) ([]byte, error)
+	TranslateStream(body io.ReadCloser) io.ReadCloser
+}
+
+type RequestAuthorizer interface {
+	AuthorizeRequest(req *http.Request, params config.UpstreamParams) error
+}
+
+type UpstreamRequest struct {
+	Path     string
+	RawQuery string
+	Body     []byte
 }
@@ -3,6 +3,7 @@ package adapter
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -19,6 +20,30 @@ func NewAnthropicCompatibleAdapter() *AnthropicCompatibleAdapter {
 }
 
 func (a *AnthropicCompatibleAdapter) BuildUpstreamURL(apiBase, upstreamPath, rawQuery string) (string, error) {
+	return joinURL(apiBase, upstreamPath, rawQuery)
+}
+
+func (a *AnthropicCompatibleAdapter) ApplyAuthHeaders(headers http.Header, params config.UpstreamParams) {
+	applyAuth(headers, params)
+}
+
+func (a *AnthropicCompatibleAdapter) TranslateRequest(upstreamPath string, payload map[string]any) (UpstreamRequest, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return UpstreamRequest{}, fmt.Errorf("marshal request payload: %w", err)
+	}
+	return UpstreamRequest{Path: upstreamPath, Body: body}, nil
+}
+
+func (a *AnthropicCompatibleAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (a *AnthropicCompatibleAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	return body
+}
+
+func joinURL(apiBase, upstreamPath, rawQuery string) (string, error) {
 	base, err := url.Parse(apiBase)
 	if err != nil {
 		return "", fmt.Errorf("parse api_base: %w", err)
@@ -30,7 +55,7 @@ func (a *AnthropicCompatibleAdapter) BuildUpstreamURL(apiBase, upstreamPath, raw
 	return base.String(), nil
 }
 
-func (a *AnthropicCompatibleAdapter) ApplyAuthHeaders(headers http.Header, params config.UpstreamParams) {
+func applyAuth(headers http.Header, params config.UpstreamParams) {
 	headers.Del("Authorization")
 	headers.Del("x-api-key")
 	switch params.AuthType {
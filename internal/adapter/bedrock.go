@@ -0,0 +1,240 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"anthropic-gateway/internal/aws"
+	"anthropic-gateway/internal/config"
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+const (
+	bedrockAnthropicVersion = "bedrock-2023-05-31"
+	bedrockSigningService   = "bedrock"
+)
+
+type BedrockAdapter struct{}
+
+func NewBedrockAdapter() *BedrockAdapter {
+	return &BedrockAdapter{}
+}
+
+func (a *BedrockAdapter) BuildUpstreamURL(apiBase, upstreamPath, rawQuery string) (string, error) {
+	base, err := url.Parse(apiBase)
+	if err != nil {
+		return "", fmt.Errorf("parse api_base: %w", err)
+	}
+
+	rawPath := strings.TrimRight(base.EscapedPath(), "/") + "/" + strings.TrimLeft(upstreamPath, "/")
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return "", fmt.Errorf("unescape upstream path: %w", err)
+	}
+	base.Path = path
+	base.RawPath = rawPath
+	base.RawQuery = rawQuery
+	return base.String(), nil
+}
+
+func (a *BedrockAdapter) ApplyAuthHeaders(headers http.Header, params config.UpstreamParams) {
+	headers.Del("Authorization")
+	headers.Del("x-api-key")
+	headers.Del("anthropic-version")
+	if params.AuthType == config.AuthTypeBearer {
+		headers.Set("Authorization", "Bearer "+params.APIKey)
+	}
+}
+
+func (a *BedrockAdapter) AuthorizeRequest(req *http.Request, params config.UpstreamParams) error {
+	if params.AuthType != config.AuthTypeSigV4 {
+		return nil
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("read request body: %w", err)
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("read request body: %w", err)
+		}
+	}
+
+	creds := aws.Credentials{
+		AccessKeyID:     params.AWSAccessKeyID,
+		SecretAccessKey: params.AWSSecretAccessKey,
+		SessionToken:    params.AWSSessionToken,
+	}
+	if err := aws.SignRequest(req, body, creds, params.AWSRegion, bedrockSigningService, time.Now()); err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamAuth, err)
+	}
+	return nil
+}
+
+func (a *BedrockAdapter) BuildModelsResponse(cfg *config.Config) models.ListResponse {
+	return models.BuildListResponse(cfg)
+}
+
+func (a *BedrockAdapter) NormalizeUpstreamError(statusCode int, upstreamBody []byte, requestID string) []byte {
+	message := extractMessage(upstreamBody)
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return apierrors.Marshal(errorTypeForStatus(statusCode), message, requestID)
+}
+
+func (a *BedrockAdapter) TranslateRequest(upstreamPath string, payload map[string]any) (UpstreamRequest, error) {
+	if strings.TrimRight(upstreamPath, "/") != "/v1/messages" {
+		return UpstreamRequest{}, ErrUnsupportedPath
+	}
+
+	model, _ := payload["model"].(string)
+	if strings.TrimSpace(model) == "" {
+		return UpstreamRequest{}, fmt.Errorf("%w: model is required", ErrInvalidRequest)
+	}
+	stream, _ := payload["stream"].(bool)
+
+	body := make(map[string]any, len(payload)+1)
+	for k, v := range payload {
+		if k == "model" || k == "stream" {
+			continue
+		}
+		body[k] = v
+	}
+	if _, ok := body["anthropic_version"]; !ok {
+		body["anthropic_version"] = bedrockAnthropicVersion
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return UpstreamRequest{}, fmt.Errorf("marshal invoke request: %w", err)
+	}
+
+	action := "invoke"
+	if stream {
+		action = "invoke-with-response-stream"
+	}
+	modelID := strings.ReplaceAll(url.PathEscape(model), ":", "%3A")
+	return UpstreamRequest{Path: "/model/" + modelID + "/" + action, Body: encoded}, nil
+}
+
+func (a *BedrockAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (a *BedrockAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	return &bedrockStream{src: body, reader: aws.NewEventStreamReader(body)}
+}
+
+type bedrockStream struct {
+	src     io.ReadCloser
+	reader  *aws.EventStreamReader
+	buf     bytes.Buffer
+	done    bool
+	stopped bool
+}
+
+func (s *bedrockStream) Read(p []byte) (int, error) {
+	for s.buf.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		msg, err := s.reader.Next()
+		if err != nil {
+			s.done = true
+			switch {
+			case errors.Is(err, io.EOF):
+				if !s.stopped {
+					s.fail("api_error", "upstream stream ended unexpectedly")
+				}
+			case errors.Is(err, aws.ErrInvalidFrame):
+				s.fail("api_error", "invalid upstream stream frame")
+			default:
+				return 0, err
+			}
+			continue
+		}
+		s.handle(msg)
+	}
+	return s.buf.Read(p)
+}
+
+func (s *bedrockStream) handle(msg aws.Message) {
+	switch msg.Headers[":message-type"] {
+	case "exception", "error":
+		message := extractMessage(msg.Payload)
+		if message == "" {
+			message = msg.Headers[":error-message"]
+		}
+		if message == "" {
+			message = "upstream stream error"
+		}
+		s.done = true
+		s.fail(bedrockErrorType(msg.Headers[":exception-type"]), message)
+		return
+	}
+	if msg.Headers[":event-type"] != "chunk" {
+		return
+	}
+
+	var chunk struct {
+		Bytes []byte `json:"bytes"`
+	}
+	if err := json.Unmarshal(msg.Payload, &chunk); err != nil || len(chunk.Bytes) == 0 {
+		s.done = true
+		s.fail("api_error", "invalid upstream stream chunk")
+		return
+	}
+	var event struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(chunk.Bytes, &event); err != nil || event.Type == "" {
+		s.done = true
+		s.fail("api_error", "invalid upstream stream chunk")
+		return
+	}
+	if event.Type == models.EventMessageStop {
+		s.stopped = true
+	}
+	s.buf.Write(sse.Encode(event.Type, chunk.Bytes))
+}
+
+func (s *bedrockStream) fail(errorType, message string) {
+	encoded, err := sse.EncodeJSON(models.EventError, models.StreamEvent{
+		Type:  models.EventError,
+		Error: &apierrors.Inner{Type: errorType, Message: message},
+	})
+	if err != nil {
+		return
+	}
+	s.buf.Write(encoded)
+}
+
+func (s *bedrockStream) Close() error {
+	return s.src.Close()
+}
+
+func bedrockErrorType(exceptionType string) string {
+	switch exceptionType {
+	case "throttlingException":
+		return "rate_limit_error"
+	case "serviceUnavailableException":
+		return "overloaded_error"
+	case "validationException":
+		return "invalid_request_error"
+	default:
+		return "api_error"
+	}
+}
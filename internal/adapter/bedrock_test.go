@@ -0,0 +1,133 @@
+package adapter_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/adapter"
+	"anthropic-gateway/internal/aws"
+	"anthropic-gateway/internal/config"
+)
+
+func TestBedrockTranslateRequest(t *testing.T) {
+	ad := adapter.NewBedrockAdapter()
+	req, err := ad.TranslateRequest("/v1/messages", map[string]any{
+		"model":      "anthropic.claude-sonnet-4-20250514-v1:0",
+		"stream":     true,
+		"max_tokens": 64,
+		"messages":   []any{map[string]any{"role": "user", "content": "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("translate request: %v", err)
+	}
+	if req.Path != "/model/anthropic.claude-sonnet-4-20250514-v1%3A0/invoke-with-response-stream" {
+		t.Fatalf("path = %q", req.Path)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if _, ok := body["model"]; ok {
+		t.Fatalf("model should move into the path: %s", req.Body)
+	}
+	if _, ok := body["stream"]; ok {
+		t.Fatalf("stream should be dropped: %s", req.Body)
+	}
+	if body["anthropic_version"] != "bedrock-2023-05-31" {
+		t.Fatalf("anthropic_version = %v", body["anthropic_version"])
+	}
+
+	upstreamURL, err := ad.BuildUpstreamURL("https://bedrock-runtime.us-east-1.amazonaws.com", req.Path, "")
+	if err != nil {
+		t.Fatalf("build url: %v", err)
+	}
+	if upstreamURL != "https://bedrock-runtime.us-east-1.amazonaws.com/model/anthropic.claude-sonnet-4-20250514-v1%3A0/invoke-with-response-stream" {
+		t.Fatalf("url = %q", upstreamURL)
+	}
+
+	if _, err := ad.TranslateRequest("/v1/messages/count_tokens", map[string]any{"model": "m"}); err != adapter.ErrUnsupportedPath {
+		t.Fatalf("expected ErrUnsupportedPath, got %v", err)
+	}
+}
+
+func TestBedrockAuthorizeRequestSigV4(t *testing.T) {
+	ad := adapter.NewBedrockAdapter()
+	req, _ := http.NewRequest(http.MethodPost, "https://bedrock-runtime.us-west-2.amazonaws.com/model/m/invoke", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("x-api-key", "client-key")
+	params := config.UpstreamParams{
+		AuthType:           config.AuthTypeSigV4,
+		AWSRegion:          "us-west-2",
+		AWSAccessKeyID:     "AKID",
+		AWSSecretAccessKey: "secret",
+	}
+
+	ad.ApplyAuthHeaders(req.Header, params)
+	if err := ad.AuthorizeRequest(req, params); err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-west-2/bedrock/aws4_request") {
+		t.Fatalf("authorization = %q", auth)
+	}
+	if req.Header.Get("x-api-key") != "" {
+		t.Fatalf("client key leaked")
+	}
+}
+
+func TestBedrockTranslateStream(t *testing.T) {
+	var upstream bytes.Buffer
+	for _, event := range []string{
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[],"usage":{"input_tokens":3,"output_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1}}`,
+		`{"type":"message_stop"}`,
+	} {
+		upstream.Write(bedrockChunk(event))
+	}
+
+	events := translateStream(t, adapter.NewBedrockAdapter(), upstream.String())
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.Type)
+	}
+	want := "message_start,content_block_start,content_block_delta,content_block_stop,message_delta,message_stop"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("events = %v", names)
+	}
+	if events[2].Delta.Text != "hi" {
+		t.Fatalf("delta = %+v", events[2].Delta)
+	}
+}
+
+func TestBedrockTranslateStreamException(t *testing.T) {
+	var upstream bytes.Buffer
+	upstream.Write(bedrockChunk(`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[],"usage":{"input_tokens":3,"output_tokens":0}}}`))
+	upstream.Write(aws.EncodeMessage(map[string]string{
+		":message-type":   "exception",
+		":exception-type": "throttlingException",
+	}, []byte(`{"message":"Too many requests"}`)))
+
+	stream := adapter.NewBedrockAdapter().TranslateStream(io.NopCloser(&upstream))
+	out, _ := io.ReadAll(stream)
+	if !strings.Contains(string(out), "event: error") || !strings.Contains(string(out), `"type":"rate_limit_error"`) || !strings.Contains(string(out), "Too many requests") {
+		t.Fatalf("unexpected stream: %s", out)
+	}
+}
+
+func bedrockChunk(event string) []byte {
+	payload, _ := json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString([]byte(event))})
+	return aws.EncodeMessage(map[string]string{
+		":message-type": "event",
+		":event-type":   "chunk",
+		":content-type": "application/json",
+	}, payload)
+}
@@ -0,0 +1,500 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"anthropic-gateway/internal/config"
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+const geminiAPIVersion = "v1beta"
+
+type GeminiAdapter struct{}
+
+func NewGeminiAdapter() *GeminiAdapter {
+	return &GeminiAdapter{}
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent         `json:"contents"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	TopK            *int     `json:"topK,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates    []geminiCandidate    `json:"candidates"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string               `json:"modelVersion,omitempty"`
+	ResponseID    string               `json:"responseId,omitempty"`
+	TotalTokens   *int                 `json:"totalTokens,omitempty"`
+	Error         *struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+}
+
+func (a *GeminiAdapter) BuildUpstreamURL(apiBase, upstreamPath, rawQuery string) (string, error) {
+	return joinURL(apiBase, upstreamPath, rawQuery)
+}
+
+func (a *GeminiAdapter) ApplyAuthHeaders(headers http.Header, params config.UpstreamParams) {
+	headers.Del("Authorization")
+	headers.Del("x-api-key")
+	headers.Del("x-goog-api-key")
+	headers.Del("anthropic-version")
+	headers.Del("anthropic-beta")
+	switch params.AuthType {
+	case config.AuthTypeBearer:
+		headers.Set("Authorization", "Bearer "+params.APIKey)
+	case config.AuthTypeXAPIKey:
+		headers.Set("x-goog-api-key", params.APIKey)
+	}
+}
+
+func (a *GeminiAdapter) AuthorizeRequest(req *http.Request, params config.UpstreamParams) error {
+	if params.AuthType != config.AuthTypeQuery {
+		return nil
+	}
+	query := req.URL.Query()
+	query.Set("key", params.APIKey)
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+func (a *GeminiAdapter) BuildModelsResponse(cfg *config.Config) models.ListResponse {
+	return models.BuildListResponse(cfg)
+}
+
+func (a *GeminiAdapter) NormalizeUpstreamError(statusCode int, upstreamBody []byte, requestID string) []byte {
+	message := extractMessage(upstreamBody)
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return apierrors.Marshal(errorTypeForStatus(statusCode), message, requestID)
+}
+
+func (a *GeminiAdapter) TranslateRequest(upstreamPath string, payload map[string]any) (UpstreamRequest, error) {
+	req, err := decodeMessagesRequest(payload)
+	if err != nil {
+		return UpstreamRequest{}, err
+	}
+	model := url.PathEscape(req.Model)
+
+	switch strings.TrimRight(upstreamPath, "/") {
+	case "/v1/messages":
+		body, err := toGeminiRequest(req)
+		if err != nil {
+			return UpstreamRequest{}, err
+		}
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return UpstreamRequest{}, fmt.Errorf("marshal generateContent request: %w", err)
+		}
+		if req.Stream {
+			return UpstreamRequest{
+				Path:     "/" + geminiAPIVersion + "/models/" + model + ":streamGenerateContent",
+				RawQuery: "alt=sse",
+				Body:     encoded,
+			}, nil
+		}
+		return UpstreamRequest{Path: "/" + geminiAPIVersion + "/models/" + model + ":generateContent", Body: encoded}, nil
+	case "/v1/messages/count_tokens":
+		body, err := toGeminiRequest(req)
+		if err != nil {
+			return UpstreamRequest{}, err
+		}
+		encoded, err := json.Marshal(map[string]any{
+			"generateContentRequest": map[string]any{
+				"model":             "models/" + req.Model,
+				"contents":          body.Contents,
+				"systemInstruction": body.SystemInstruction,
+				"tools":             body.Tools,
+			},
+		})
+		if err != nil {
+			return UpstreamRequest{}, fmt.Errorf("marshal countTokens request: %w", err)
+		}
+		return UpstreamRequest{Path: "/" + geminiAPIVersion + "/models/" + model + ":countTokens", Body: encoded}, nil
+	default:
+		return UpstreamRequest{}, ErrUnsupportedPath
+	}
+}
+
+func (a *GeminiAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decode gemini response: %w", err)
+	}
+	if resp.TotalTokens != nil && len(resp.Candidates) == 0 {
+		return json.Marshal(map[string]int{"input_tokens": *resp.TotalTokens})
+	}
+	if len(resp.Candidates) == 0 {
+		return nil, fmt.Errorf("gemini response has no candidates")
+	}
+
+	candidate := resp.Candidates[0]
+	msg := models.Message{
+		ID:      resp.ResponseID,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.ModelVersion,
+		Content: []models.ContentBlock{},
+		Usage:   fromGeminiUsage(resp.UsageMetadata),
+	}
+	hasToolUse := false
+	for i, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			hasToolUse = true
+			msg.Content = append(msg.Content, models.ContentBlock{
+				Type:  "tool_use",
+				ID:    geminiCallID(part.FunctionCall, i),
+				Name:  part.FunctionCall.Name,
+				Input: geminiArgs(part.FunctionCall.Args),
+			})
+		case part.Text != "" && !part.Thought:
+			if n := len(msg.Content); n > 0 && msg.Content[n-1].Type == "text" {
+				msg.Content[n-1].Text += part.Text
+				continue
+			}
+			msg.Content = append(msg.Content, models.ContentBlock{Type: "text", Text: part.Text})
+		}
+	}
+	msg.StopReason = models.StringPtr(geminiStopReason(candidate.FinishReason, hasToolUse))
+	return json.Marshal(msg)
+}
+
+func (a *GeminiAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	state := &geminiStreamState{reader: sse.NewReader(body), builder: &streamBuilder{}}
+	return newTranslatingStream(body, state.builder, state.step)
+}
+
+type geminiStreamState struct {
+	reader     *sse.Reader
+	builder    *streamBuilder
+	sawFinish  bool
+	hasToolUse bool
+	parts      int
+}
+
+func (s *geminiStreamState) step() error {
+	event, err := s.reader.Next()
+	if err != nil {
+		if err == io.EOF && s.sawFinish {
+			s.builder.finish()
+		}
+		return err
+	}
+	if strings.TrimSpace(string(event.Data)) == "" {
+		return nil
+	}
+
+	var chunk geminiResponse
+	if err := json.Unmarshal(event.Data, &chunk); err != nil {
+		s.builder.fail("api_error", "invalid upstream stream chunk")
+		return nil
+	}
+	if chunk.Error != nil {
+		message := chunk.Error.Message
+		if message == "" {
+			message = "upstream stream error"
+		}
+		s.builder.fail("api_error", message)
+		return nil
+	}
+
+	if chunk.UsageMetadata != nil {
+		s.builder.usage = fromGeminiUsage(chunk.UsageMetadata)
+	}
+	s.builder.start(chunk.ResponseID, chunk.ModelVersion)
+	if len(chunk.Candidates) == 0 {
+		return nil
+	}
+
+	candidate := chunk.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		s.parts++
+		switch {
+		case part.FunctionCall != nil:
+			s.hasToolUse = true
+			s.builder.toolUse(geminiCallID(part.FunctionCall, s.parts), part.FunctionCall.Name)
+			s.builder.toolInput(string(geminiArgs(part.FunctionCall.Args)))
+			s.builder.closeBlock()
+		case part.Text != "" && !part.Thought:
+			s.builder.text(part.Text)
+		}
+	}
+	if candidate.FinishReason != "" {
+		s.sawFinish = true
+		s.builder.stopReason = geminiStopReason(candidate.FinishReason, s.hasToolUse)
+	}
+	return nil
+}
+
+func toGeminiRequest(req models.MessagesRequest) (geminiRequest, error) {
+	out := geminiRequest{Contents: []geminiContent{}}
+	if system := models.ContentText(req.System); system != "" {
+		out.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+
+	if req.MaxTokens > 0 || req.Temperature != nil || req.TopP != nil || req.TopK != nil || len(req.StopSequences) > 0 {
+		out.GenerationConfig = &geminiGenerationConfig{
+			MaxOutputTokens: req.MaxTokens,
+			Temperature:     req.Temperature,
+			TopP:            req.TopP,
+			TopK:            req.TopK,
+			StopSequences:   req.StopSequences,
+		}
+	}
+
+	toolNames := make(map[string]string)
+	for i, msg := range req.Messages {
+		blocks, err := msg.Blocks()
+		if err != nil {
+			return out, fmt.Errorf("%w: messages[%d].content: %v", ErrInvalidRequest, i, err)
+		}
+
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+		content := geminiContent{Role: role}
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				if block.Text != "" {
+					content.Parts = append(content.Parts, geminiPart{Text: block.Text})
+				}
+			case "image":
+				if part, ok := geminiImagePart(block.Source); ok {
+					content.Parts = append(content.Parts, part)
+				}
+			case "tool_use":
+				toolNames[block.ID] = block.Name
+				content.Parts = append(content.Parts, geminiPart{FunctionCall: &geminiFunctionCall{
+					Name: block.Name,
+					Args: geminiArgs(block.Input),
+				}})
+			case "tool_result":
+				name := toolNames[block.ToolUseID]
+				if name == "" {
+					name = block.ToolUseID
+				}
+				response := map[string]any{"content": models.ContentText(block.Content)}
+				if block.IsError {
+					response = map[string]any{"error": models.ContentText(block.Content)}
+				}
+				content.Parts = append(content.Parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+					Name:     name,
+					Response: response,
+				}})
+			}
+		}
+		if len(content.Parts) > 0 {
+			out.Contents = append(out.Contents, content)
+		}
+	}
+
+	var declarations []geminiFunctionDeclaration
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "custom" {
+			continue
+		}
+		declarations = append(declarations, geminiFunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  geminiSchema(tool.InputSchema),
+		})
+	}
+	if len(declarations) > 0 {
+		out.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+		if req.ToolChoice != nil {
+			calling := geminiFunctionCallingConfig{Mode: "AUTO"}
+			switch req.ToolChoice.Type {
+			case "any":
+				calling.Mode = "ANY"
+			case "none":
+				calling.Mode = "NONE"
+			case "tool":
+				calling.Mode = "ANY"
+				calling.AllowedFunctionNames = []string{req.ToolChoice.Name}
+			}
+			out.ToolConfig = &geminiToolConfig{FunctionCallingConfig: calling}
+		}
+	}
+	return out, nil
+}
+
+func geminiImagePart(source *models.ImageSource) (geminiPart, bool) {
+	if source == nil {
+		return geminiPart{}, false
+	}
+	switch source.Type {
+	case "base64":
+		return geminiPart{InlineData: &geminiBlob{MimeType: source.MediaType, Data: source.Data}}, true
+	case "url":
+		return geminiPart{FileData: &geminiFileData{MimeType: source.MediaType, FileURI: source.URL}}, true
+	default:
+		return geminiPart{}, false
+	}
+}
+
+var geminiUnsupportedSchemaKeys = []string{"$schema", "$id", "additionalProperties", "examples"}
+
+func geminiSchema(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var schema any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return raw
+	}
+	cleaned, err := json.Marshal(stripSchemaKeys(schema))
+	if err != nil {
+		return raw
+	}
+	return cleaned
+}
+
+func stripSchemaKeys(v any) any {
+	switch node := v.(type) {
+	case map[string]any:
+		for _, key := range geminiUnsupportedSchemaKeys {
+			delete(node, key)
+		}
+		for key, child := range node {
+			node[key] = stripSchemaKeys(child)
+		}
+		return node
+	case []any:
+		for i, child := range node {
+			node[i] = stripSchemaKeys(child)
+		}
+		return node
+	default:
+		return v
+	}
+}
+
+func geminiArgs(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 || string(raw) == "null" {
+		return json.RawMessage(`{}`)
+	}
+	return raw
+}
+
+func geminiCallID(call *geminiFunctionCall, index int) string {
+	if call.ID != "" {
+		return call.ID
+	}
+	return fmt.Sprintf("toolu_%s_%d", call.Name, index)
+}
+
+func fromGeminiUsage(usage *geminiUsageMetadata) models.Usage {
+	if usage == nil {
+		return models.Usage{}
+	}
+	return models.Usage{
+		InputTokens:          usage.PromptTokenCount - usage.CachedContentTokenCount,
+		OutputTokens:         usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+		CacheReadInputTokens: usage.CachedContentTokenCount,
+	}
+}
+
+func geminiStopReason(finishReason string, hasToolUse bool) string {
+	if hasToolUse {
+		return models.StopReasonToolUse
+	}
+	switch finishReason {
+	case "MAX_TOKENS":
+		return models.StopReasonMaxTokens
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return models.StopReasonRefusal
+	default:
+		return models.StopReasonEndTurn
+	}
+}
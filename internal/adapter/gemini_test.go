@@ -0,0 +1,212 @@
+package adapter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/adapter"
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/models"
+)
+
+func TestGeminiTranslateRequest(t *testing.T) {
+	ad := adapter.NewGeminiAdapter()
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"model": "gemini-2.5-pro",
+		"max_tokens": 512,
+		"stream": true,
+		"system": "be brief",
+		"tools": [{"name":"get_weather","description":"weather","input_schema":{"$schema":"http://json-schema.org/draft-07/schema#","type":"object","additionalProperties":false,"properties":{"city":{"type":"string"}}}}],
+		"tool_choice": {"type":"any"},
+		"messages": [
+			{"role":"user","content":"weather in Paris?"},
+			{"role":"assistant","content":[
+				{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}
+			]},
+			{"role":"user","content":[
+				{"type":"tool_result","tool_use_id":"toolu_1","content":"sunny"}
+			]}
+		]
+	}`), &payload); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+
+	req, err := ad.TranslateRequest("/v1/messages", payload)
+	if err != nil {
+		t.Fatalf("translate request: %v", err)
+	}
+	if req.Path != "/v1beta/models/gemini-2.5-pro:streamGenerateContent" || req.RawQuery != "alt=sse" {
+		t.Fatalf("path = %q query = %q", req.Path, req.RawQuery)
+	}
+
+	var out struct {
+		SystemInstruction struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"systemInstruction"`
+		Contents []struct {
+			Role  string `json:"role"`
+			Parts []struct {
+				Text         string `json:"text"`
+				FunctionCall *struct {
+					Name string         `json:"name"`
+					Args map[string]any `json:"args"`
+				} `json:"functionCall"`
+				FunctionResponse *struct {
+					Name     string         `json:"name"`
+					Response map[string]any `json:"response"`
+				} `json:"functionResponse"`
+			} `json:"parts"`
+		} `json:"contents"`
+		Tools []struct {
+			FunctionDeclarations []struct {
+				Name       string         `json:"name"`
+				Parameters map[string]any `json:"parameters"`
+			} `json:"functionDeclarations"`
+		} `json:"tools"`
+		ToolConfig struct {
+			FunctionCallingConfig struct {
+				Mode string `json:"mode"`
+			} `json:"functionCallingConfig"`
+		} `json:"toolConfig"`
+		GenerationConfig struct {
+			MaxOutputTokens int `json:"maxOutputTokens"`
+		} `json:"generationConfig"`
+	}
+	if err := json.Unmarshal(req.Body, &out); err != nil {
+		t.Fatalf("decode translated body: %v", err)
+	}
+
+	if out.SystemInstruction.Parts[0].Text != "be brief" || out.GenerationConfig.MaxOutputTokens != 512 {
+		t.Fatalf("unexpected system/generation config: %s", req.Body)
+	}
+	if len(out.Contents) != 3 || out.Contents[1].Role != "model" {
+		t.Fatalf("contents = %s", req.Body)
+	}
+	if call := out.Contents[1].Parts[0].FunctionCall; call == nil || call.Name != "get_weather" || call.Args["city"] != "Paris" {
+		t.Fatalf("function call = %s", req.Body)
+	}
+	if resp := out.Contents[2].Parts[0].FunctionResponse; resp == nil || resp.Name != "get_weather" || resp.Response["content"] != "sunny" {
+		t.Fatalf("function response = %s", req.Body)
+	}
+	params := out.Tools[0].FunctionDeclarations[0].Parameters
+	if _, ok := params["$schema"]; ok {
+		t.Fatalf("$schema should be stripped: %v", params)
+	}
+	if _, ok := params["additionalProperties"]; ok {
+		t.Fatalf("additionalProperties should be stripped: %v", params)
+	}
+	if out.ToolConfig.FunctionCallingConfig.Mode != "ANY" {
+		t.Fatalf("tool config = %s", req.Body)
+	}
+}
+
+func TestGeminiTranslateResponse(t *testing.T) {
+	ad := adapter.NewGeminiAdapter()
+	body, err := ad.TranslateResponse([]byte(`{
+		"candidates": [{
+			"content": {"role":"model","parts":[
+				{"text":"thinking...","thought":true},
+				{"text":"Checking."},
+				{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}
+			]},
+			"finishReason": "STOP"
+		}],
+		"usageMetadata": {"promptTokenCount": 20, "candidatesTokenCount": 7, "cachedContentTokenCount": 5, "thoughtsTokenCount": 3},
+		"modelVersion": "gemini-2.5-pro",
+		"responseId": "resp_1"
+	}`))
+	if err != nil {
+		t.Fatalf("translate response: %v", err)
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatalf("decode message: %v", err)
+	}
+	if msg.ID != "resp_1" || len(msg.Content) != 2 || msg.Content[0].Text != "Checking." {
+		t.Fatalf("message = %s", body)
+	}
+	if msg.Content[1].Type != "tool_use" || msg.Content[1].Name != "get_weather" || msg.Content[1].ID == "" {
+		t.Fatalf("tool block = %+v", msg.Content[1])
+	}
+	if *msg.StopReason != "tool_use" {
+		t.Fatalf("stop_reason = %s", *msg.StopReason)
+	}
+	if msg.Usage.InputTokens != 15 || msg.Usage.CacheReadInputTokens != 5 || msg.Usage.OutputTokens != 10 {
+		t.Fatalf("usage = %+v", msg.Usage)
+	}
+}
+
+func TestGeminiTranslateCountTokens(t *testing.T) {
+	ad := adapter.NewGeminiAdapter()
+	req, err := ad.TranslateRequest("/v1/messages/count_tokens", map[string]any{
+		"model":    "gemini-2.5-flash",
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("translate request: %v", err)
+	}
+	if req.Path != "/v1beta/models/gemini-2.5-flash:countTokens" {
+		t.Fatalf("path = %q", req.Path)
+	}
+
+	body, err := ad.TranslateResponse([]byte(`{"totalTokens": 42}`))
+	if err != nil {
+		t.Fatalf("translate response: %v", err)
+	}
+	if string(body) != `{"input_tokens":42}` {
+		t.Fatalf("body = %s", body)
+	}
+}
+
+func TestGeminiTranslateStream(t *testing.T) {
+	events := translateStream(t, adapter.NewGeminiAdapter(), `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"modelVersion":"gemini-2.5-pro","responseId":"r1"}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2}}
+
+`)
+
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.Type)
+	}
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v", names)
+	}
+	delta := events[5]
+	if *delta.Delta.StopReason != "max_tokens" || delta.Usage.InputTokens != 4 || delta.Usage.OutputTokens != 2 {
+		t.Fatalf("message_delta = %+v usage=%+v", delta.Delta, delta.Usage)
+	}
+}
+
+func TestGeminiAuthorizeRequestQueryKey(t *testing.T) {
+	ad := adapter.NewGeminiAdapter()
+	req, err := http.NewRequest(http.MethodPost, "https://generativelanguage.googleapis.com/v1beta/models/m:streamGenerateContent?alt=sse", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("x-api-key", "client-key")
+
+	params := config.UpstreamParams{APIKey: "gemini-key", AuthType: config.AuthTypeQuery}
+	ad.ApplyAuthHeaders(req.Header, params)
+	if err := ad.AuthorizeRequest(req, params); err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	if req.Header.Get("x-api-key") != "" || req.Header.Get("Authorization") != "" {
+		t.Fatalf("client credentials leaked: %v", req.Header)
+	}
+	if got := req.URL.Query(); got.Get("key") != "gemini-key" || got.Get("alt") != "sse" {
+		t.Fatalf("query = %q", req.URL.RawQuery)
+	}
+}
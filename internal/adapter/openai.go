@@ -0,0 +1,441 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"anthropic-gateway/internal/config"
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+)
+
+const openAIChatCompletionsPath = "/v1/chat/completions"
+
+type OpenAIAdapter struct{}
+
+func NewOpenAIAdapter() *OpenAIAdapter {
+	return &OpenAIAdapter{}
+}
+
+type openAIChatRequest struct {
+	Model             string               `json:"model"`
+	Messages          []openAIMessage      `json:"messages"`
+	MaxTokens         *int                 `json:"max_tokens,omitempty"`
+	Temperature       *float64             `json:"temperature,omitempty"`
+	TopP              *float64             `json:"top_p,omitempty"`
+	Stop              []string             `json:"stop,omitempty"`
+	Stream            bool                 `json:"stream,omitempty"`
+	StreamOptions     *openAIStreamOptions `json:"stream_options,omitempty"`
+	Tools             []openAITool         `json:"tools,omitempty"`
+	ToolChoice        any                  `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool                `json:"parallel_tool_calls,omitempty"`
+	User              string               `json:"user,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role,omitempty"`
+	Content    json.RawMessage  `json:"content,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    *int               `json:"index,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+type openAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type openAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int            `json:"index"`
+	Message      *openAIMessage `json:"message,omitempty"`
+	Delta        *openAIMessage `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+type openAIUsage struct {
+	PromptTokens        int                        `json:"prompt_tokens"`
+	CompletionTokens    int                        `json:"completion_tokens"`
+	TotalTokens         int                        `json:"total_tokens"`
+	PromptTokensDetails *openAIPromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type openAIPromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+func (a *OpenAIAdapter) BuildUpstreamURL(apiBase, upstreamPath, rawQuery string) (string, error) {
+	return joinURL(apiBase, upstreamPath, rawQuery)
+}
+
+func (a *OpenAIAdapter) ApplyAuthHeaders(headers http.Header, params config.UpstreamParams) {
+	headers.Del("anthropic-version")
+	headers.Del("anthropic-beta")
+	applyAuth(headers, params)
+}
+
+func (a *OpenAIAdapter) BuildModelsResponse(cfg *config.Config) models.ListResponse {
+	return models.BuildListResponse(cfg)
+}
+
+func (a *OpenAIAdapter) NormalizeUpstreamError(statusCode int, upstreamBody []byte, requestID string) []byte {
+	if apierrors.IsAnthropicErrorPayload(upstreamBody) {
+		return upstreamBody
+	}
+
+	message := extractMessage(upstreamBody)
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return apierrors.Marshal(errorTypeForStatus(statusCode), message, requestID)
+}
+
+func (a *OpenAIAdapter) TranslateRequest(upstreamPath string, payload map[string]any) (UpstreamRequest, error) {
+	if strings.TrimRight(upstreamPath, "/") != "/v1/messages" {
+		return UpstreamRequest{}, ErrUnsupportedPath
+	}
+
+	req, err := decodeMessagesRequest(payload)
+	if err != nil {
+		return UpstreamRequest{}, err
+	}
+	chatReq, err := toOpenAIChatRequest(req)
+	if err != nil {
+		return UpstreamRequest{}, err
+	}
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return UpstreamRequest{}, fmt.Errorf("marshal chat completions request: %w", err)
+	}
+	return UpstreamRequest{Path: openAIChatCompletionsPath, Body: body}, nil
+}
+
+func (a *OpenAIAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	var resp openAIChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decode chat completions response: %w", err)
+	}
+	msg, err := fromOpenAIChatResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(msg)
+}
+
+func decodeMessagesRequest(payload map[string]any) (models.MessagesRequest, error) {
+	var req models.MessagesRequest
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return req, fmt.Errorf("marshal request payload: %w", err)
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return req, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return req, nil
+}
+
+func toOpenAIChatRequest(req models.MessagesRequest) (openAIChatRequest, error) {
+	out := openAIChatRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.StopSequences,
+		Stream:      req.Stream,
+	}
+	if req.MaxTokens > 0 {
+		maxTokens := req.MaxTokens
+		out.MaxTokens = &maxTokens
+	}
+	if req.Stream {
+		out.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if req.Metadata != nil {
+		out.User = req.Metadata.UserID
+	}
+
+	if system := models.ContentText(req.System); system != "" {
+		out.Messages = append(out.Messages, openAIMessage{Role: "system", Content: jsonString(system)})
+	}
+	for i, msg := range req.Messages {
+		blocks, err := msg.Blocks()
+		if err != nil {
+			return out, fmt.Errorf("%w: messages[%d].content: %v", ErrInvalidRequest, i, err)
+		}
+		switch msg.Role {
+		case "user":
+			out.Messages = append(out.Messages, toOpenAIUserMessages(blocks)...)
+		case "assistant":
+			out.Messages = append(out.Messages, toOpenAIAssistantMessage(blocks))
+		default:
+			return out, fmt.Errorf("%w: messages[%d].role must be user or assistant", ErrInvalidRequest, i)
+		}
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "custom" {
+			continue
+		}
+		out.Tools = append(out.Tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if req.ToolChoice != nil && len(out.Tools) > 0 {
+		switch req.ToolChoice.Type {
+		case "auto":
+			out.ToolChoice = "auto"
+		case "any":
+			out.ToolChoice = "required"
+		case "none":
+			out.ToolChoice = "none"
+		case "tool":
+			out.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]string{"name": req.ToolChoice.Name},
+			}
+		}
+		if req.ToolChoice.DisableParallelToolUse {
+			parallel := false
+			out.ParallelToolCalls = &parallel
+		}
+	}
+	return out, nil
+}
+
+func toOpenAIUserMessages(blocks []models.ContentBlock) []openAIMessage {
+	var out []openAIMessage
+	var parts []openAIContentPart
+	textOnly := true
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, openAIContentPart{Type: "text", Text: block.Text})
+		case "image":
+			if url := imageURL(block.Source); url != "" {
+				parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: url}})
+				textOnly = false
+			}
+		case "tool_result":
+			content := models.ContentText(block.Content)
+			if block.IsError && content == "" {
+				content = "error"
+			}
+			out = append(out, openAIMessage{Role: "tool", ToolCallID: block.ToolUseID, Content: jsonString(content)})
+		}
+	}
+
+	if len(parts) == 0 {
+		return out
+	}
+	if textOnly {
+		texts := make([]string, 0, len(parts))
+		for _, part := range parts {
+			texts = append(texts, part.Text)
+		}
+		return append(out, openAIMessage{Role: "user", Content: jsonString(strings.Join(texts, "\n"))})
+	}
+	content, _ := json.Marshal(parts)
+	return append(out, openAIMessage{Role: "user", Content: content})
+}
+
+func toOpenAIAssistantMessage(blocks []models.ContentBlock) openAIMessage {
+	msg := openAIMessage{Role: "assistant"}
+	var texts []string
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if strings.TrimSpace(arguments) == "" {
+				arguments = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	if len(texts) > 0 || len(msg.ToolCalls) == 0 {
+		msg.Content = jsonString(strings.Join(texts, ""))
+	}
+	return msg
+}
+
+func fromOpenAIChatResponse(resp openAIChatResponse) (models.Message, error) {
+	msg := models.Message{
+		ID:      resp.ID,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.Model,
+		Content: []models.ContentBlock{},
+		Usage:   fromOpenAIUsage(resp.Usage),
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return msg, fmt.Errorf("chat completions response has no choices")
+	}
+
+	choice := resp.Choices[0]
+	if text := openAIContentText(choice.Message.Content); text != "" {
+		msg.Content = append(msg.Content, models.ContentBlock{Type: "text", Text: text})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		msg.Content = append(msg.Content, models.ContentBlock{
+			Type:  "tool_use",
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: toolInput(call.Function.Arguments),
+		})
+	}
+
+	finishReason := ""
+	if choice.FinishReason != nil {
+		finishReason = *choice.FinishReason
+	}
+	msg.StopReason = models.StringPtr(openAIStopReason(finishReason))
+	return msg, nil
+}
+
+func fromOpenAIUsage(usage *openAIUsage) models.Usage {
+	if usage == nil {
+		return models.Usage{}
+	}
+	out := models.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+	if usage.PromptTokensDetails != nil && usage.PromptTokensDetails.CachedTokens > 0 {
+		out.CacheReadInputTokens = usage.PromptTokensDetails.CachedTokens
+		out.InputTokens -= usage.PromptTokensDetails.CachedTokens
+	}
+	return out
+}
+
+func openAIStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return models.StopReasonMaxTokens
+	case "tool_calls", "function_call":
+		return models.StopReasonToolUse
+	case "content_filter":
+		return models.StopReasonRefusal
+	default:
+		return models.StopReasonEndTurn
+	}
+}
+
+func openAIContentText(raw json.RawMessage) string {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return ""
+	}
+	if strings.HasPrefix(trimmed, `"`) {
+		var text string
+		_ = json.Unmarshal(raw, &text)
+		return text
+	}
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "")
+}
+
+func imageURL(source *models.ImageSource) string {
+	if source == nil {
+		return ""
+	}
+	switch source.Type {
+	case "base64":
+		return "data:" + source.MediaType + ";base64," + source.Data
+	case "url":
+		return source.URL
+	default:
+		return ""
+	}
+}
+
+func toolInput(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage(`{}`)
+	}
+	return json.RawMessage(arguments)
+}
+
+func jsonString(v string) json.RawMessage {
+	raw, _ := json.Marshal(v)
+	return raw
+}
+
+func errorTypeForStatus(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return "authentication_error"
+	case statusCode == http.StatusForbidden:
+		return "permission_error"
+	case statusCode == http.StatusNotFound:
+		return "not_found_error"
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case statusCode == http.StatusServiceUnavailable || statusCode == 529:
+		return "overloaded_error"
+	case statusCode >= 500:
+		return "api_error"
+	default:
+		return "invalid_request_error"
+	}
+}
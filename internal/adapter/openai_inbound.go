@@ -0,0 +1,501 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+const defaultOpenAIInboundMaxTokens = 4096
+
+type openAIInboundRequest struct {
+	Model               string               `json:"model"`
+	Messages            []openAIMessage      `json:"messages"`
+	MaxTokens           *int                 `json:"max_tokens"`
+	MaxCompletionTokens *int                 `json:"max_completion_tokens"`
+	Temperature         *float64             `json:"temperature"`
+	TopP                *float64             `json:"top_p"`
+	Stop                json.RawMessage      `json:"stop"`
+	Stream              bool                 `json:"stream"`
+	StreamOptions       *openAIStreamOptions `json:"stream_options"`
+	Tools               []openAITool         `json:"tools"`
+	ToolChoice          json.RawMessage      `json:"tool_choice"`
+	ParallelToolCalls   *bool                `json:"parallel_tool_calls"`
+	User                string               `json:"user"`
+	N                   *int                 `json:"n"`
+}
+
+type OpenAIRequestOptions struct {
+	Model        string
+	Stream       bool
+	IncludeUsage bool
+}
+
+type openAIErrorEnvelope struct {
+	Error openAIError `json:"error"`
+}
+
+type openAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+func OpenAIRequestToMessages(body []byte) (map[string]any, OpenAIRequestOptions, error) {
+	var req openAIInboundRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, OpenAIRequestOptions{}, fmt.Errorf("%w: invalid JSON payload", ErrInvalidRequest)
+	}
+	opts := OpenAIRequestOptions{
+		Model:        req.Model,
+		Stream:       req.Stream,
+		IncludeUsage: req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+	}
+	if req.N != nil && *req.N > 1 {
+		return nil, opts, fmt.Errorf("%w: n > 1 is not supported", ErrInvalidRequest)
+	}
+
+	out := models.MessagesRequest{
+		Model:       req.Model,
+		MaxTokens:   defaultOpenAIInboundMaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	switch {
+	case req.MaxCompletionTokens != nil:
+		out.MaxTokens = *req.MaxCompletionTokens
+	case req.MaxTokens != nil:
+		out.MaxTokens = *req.MaxTokens
+	}
+	if req.User != "" {
+		out.Metadata = &models.Metadata{UserID: req.User}
+	}
+
+	stop, err := parseOpenAIStop(req.Stop)
+	if err != nil {
+		return nil, opts, err
+	}
+	out.StopSequences = stop
+
+	var systemParts []string
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			if text := openAIContentText(msg.Content); text != "" {
+				systemParts = append(systemParts, text)
+			}
+		case "user":
+			blocks, err := fromOpenAIUserContent(msg.Content)
+			if err != nil {
+				return nil, opts, fmt.Errorf("%w: messages[%d].content: %v", ErrInvalidRequest, i, err)
+			}
+			out.Messages = appendInputMessage(out.Messages, "user", blocks)
+		case "assistant":
+			var blocks []models.ContentBlock
+			if text := openAIContentText(msg.Content); text != "" {
+				blocks = append(blocks, models.ContentBlock{Type: "text", Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, models.ContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: toolInput(call.Function.Arguments),
+				})
+			}
+			out.Messages = appendInputMessage(out.Messages, "assistant", blocks)
+		case "tool":
+			block := models.ContentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   jsonString(openAIContentText(msg.Content)),
+			}
+			out.Messages = appendInputMessage(out.Messages, "user", []models.ContentBlock{block})
+		default:
+			return nil, opts, fmt.Errorf("%w: messages[%d].role %q is not supported", ErrInvalidRequest, i, msg.Role)
+		}
+	}
+	if len(systemParts) > 0 {
+		out.System = jsonString(strings.Join(systemParts, "\n\n"))
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			continue
+		}
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, models.Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	if len(out.Tools) > 0 {
+		choice, err := parseOpenAIToolChoice(req.ToolChoice)
+		if err != nil {
+			return nil, opts, err
+		}
+		if req.ParallelToolCalls != nil && !*req.ParallelToolCalls {
+			if choice == nil {
+				choice = &models.ToolChoice{Type: "auto"}
+			}
+			choice.DisableParallelToolUse = true
+		}
+		out.ToolChoice = choice
+	}
+
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return nil, opts, fmt.Errorf("marshal messages request: %w", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, opts, fmt.Errorf("decode messages request: %w", err)
+	}
+	return payload, opts, nil
+}
+
+func MessageToOpenAIResponse(body []byte, model string) ([]byte, error) {
+	var msg models.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("decode message: %w", err)
+	}
+
+	out := openAIMessage{Role: "assistant"}
+	var texts []string
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			input := string(block.Input)
+			if input == "" {
+				input = "{}"
+			}
+			out.ToolCalls = append(out.ToolCalls, openAIToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: input},
+			})
+		}
+	}
+	if len(texts) > 0 {
+		out.Content = jsonString(strings.Join(texts, ""))
+	} else {
+		out.Content = json.RawMessage("null")
+	}
+
+	stopReason := ""
+	if msg.StopReason != nil {
+		stopReason = *msg.StopReason
+	}
+	finishReason := openAIFinishReason(stopReason)
+	resp := openAIChatResponse{
+		ID:      msg.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openAIChoice{{Index: 0, Message: &out, FinishReason: &finishReason}},
+		Usage:   toOpenAIUsage(msg.Usage),
+	}
+	return json.Marshal(resp)
+}
+
+func ErrorToOpenAI(body []byte, statusCode int) []byte {
+	var envelope apierrors.Envelope
+	message := ""
+	errorType := ""
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		message = envelope.Error.Message
+		errorType = envelope.Error.Type
+	}
+	if message == "" {
+		message = extractMessage(body)
+	}
+	if errorType == "" {
+		errorType = errorTypeForStatus(statusCode)
+	}
+	return MarshalOpenAIError(errorType, message)
+}
+
+func MarshalOpenAIError(errorType, message string) []byte {
+	if strings.TrimSpace(message) == "" {
+		message = "request failed"
+	}
+	body, err := json.Marshal(openAIErrorEnvelope{Error: openAIError{Message: message, Type: errorType}})
+	if err != nil {
+		return []byte(`{"error":{"message":"failed to marshal error","type":"api_error"}}`)
+	}
+	return body
+}
+
+type OpenAIStreamEncoder struct {
+	model        string
+	includeUsage bool
+	id           string
+	created      int64
+	toolIndex    map[int]int
+	finishReason string
+	usage        models.Usage
+	done         bool
+}
+
+func NewOpenAIStreamEncoder(model string, includeUsage bool) *OpenAIStreamEncoder {
+	return &OpenAIStreamEncoder{
+		model:        model,
+		includeUsage: includeUsage,
+		created:      time.Now().Unix(),
+		toolIndex:    make(map[int]int),
+	}
+}
+
+func (e *OpenAIStreamEncoder) Encode(event sse.Event) []byte {
+	if e.done {
+		return nil
+	}
+	var ev models.StreamEvent
+	if err := json.Unmarshal(event.Data, &ev); err != nil {
+		return nil
+	}
+
+	switch ev.Type {
+	case models.EventPing:
+		return []byte(": ping\n\n")
+	case models.EventMessageStart:
+		if ev.Message != nil {
+			e.id = ev.Message.ID
+			e.usage = ev.Message.Usage
+		}
+		return e.chunk(openAIMessage{Role: "assistant", Content: jsonString("")}, nil)
+	case models.EventContentBlockStart:
+		if ev.ContentBlock == nil || ev.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		idx := len(e.toolIndex)
+		e.toolIndex[ev.Index] = idx
+		return e.chunk(openAIMessage{ToolCalls: []openAIToolCall{{
+			Index:    &idx,
+			ID:       ev.ContentBlock.ID,
+			Type:     "function",
+			Function: openAIFunctionCall{Name: ev.ContentBlock.Name},
+		}}}, nil)
+	case models.EventContentBlockDelta:
+		if ev.Delta == nil {
+			return nil
+		}
+		switch ev.Delta.Type {
+		case "text_delta":
+			if ev.Delta.Text == "" {
+				return nil
+			}
+			return e.chunk(openAIMessage{Content: jsonString(ev.Delta.Text)}, nil)
+		case "input_json_delta":
+			idx, ok := e.toolIndex[ev.Index]
+			if !ok || ev.Delta.PartialJSON == "" {
+				return nil
+			}
+			return e.chunk(openAIMessage{ToolCalls: []openAIToolCall{{
+				Index:    &idx,
+				Function: openAIFunctionCall{Arguments: ev.Delta.PartialJSON},
+			}}}, nil)
+		}
+	case models.EventMessageDelta:
+		if ev.Delta != nil && ev.Delta.StopReason != nil {
+			e.finishReason = openAIFinishReason(*ev.Delta.StopReason)
+		}
+		if ev.Usage != nil {
+			models.MergeUsage(&e.usage, *ev.Usage)
+		}
+	case models.EventMessageStop:
+		e.done = true
+		finishReason := e.finishReason
+		if finishReason == "" {
+			finishReason = "stop"
+		}
+		out := e.chunk(openAIMessage{}, &finishReason)
+		if e.includeUsage {
+			out = append(out, e.usageChunk()...)
+		}
+		return append(out, sse.Encode("", []byte("[DONE]"))...)
+	case models.EventError:
+		e.done = true
+		errorType, message := "api_error", "upstream stream error"
+		if ev.Error != nil {
+			errorType, message = ev.Error.Type, ev.Error.Message
+		}
+		out := sse.Encode("", MarshalOpenAIError(errorType, message))
+		return append(out, sse.Encode("", []byte("[DONE]"))...)
+	}
+	return nil
+}
+
+func (e *OpenAIStreamEncoder) chunk(delta openAIMessage, finishReason *string) []byte {
+	resp := openAIChatResponse{
+		ID:      e.id,
+		Object:  "chat.completion.chunk",
+		Created: e.created,
+		Model:   e.model,
+		Choices: []openAIChoice{{Index: 0, Delta: &delta, FinishReason: finishReason}},
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil
+	}
+	return sse.Encode("", data)
+}
+
+func (e *OpenAIStreamEncoder) usageChunk() []byte {
+	resp := openAIChatResponse{
+		ID:      e.id,
+		Object:  "chat.completion.chunk",
+		Created: e.created,
+		Model:   e.model,
+		Choices: []openAIChoice{},
+		Usage:   toOpenAIUsage(e.usage),
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil
+	}
+	return sse.Encode("", data)
+}
+
+func toOpenAIUsage(usage models.Usage) *openAIUsage {
+	prompt := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	out := &openAIUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      prompt + usage.OutputTokens,
+	}
+	if usage.CacheReadInputTokens > 0 {
+		out.PromptTokensDetails = &openAIPromptTokensDetails{CachedTokens: usage.CacheReadInputTokens}
+	}
+	return out
+}
+
+func openAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case models.StopReasonMaxTokens:
+		return "length"
+	case models.StopReasonToolUse:
+		return "tool_calls"
+	case models.StopReasonRefusal:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func fromOpenAIUserContent(raw json.RawMessage) ([]models.ContentBlock, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, `"`) {
+		return []models.ContentBlock{{Type: "text", Text: openAIContentText(raw)}}, nil
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, err
+	}
+	blocks := make([]models.ContentBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			blocks = append(blocks, models.ContentBlock{Type: "text", Text: part.Text})
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			blocks = append(blocks, models.ContentBlock{Type: "image", Source: imageSource(part.ImageURL.URL)})
+		}
+	}
+	return blocks, nil
+}
+
+func imageSource(url string) *models.ImageSource {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if meta, data, found := strings.Cut(rest, ","); found {
+			mediaType, _, _ := strings.Cut(meta, ";")
+			return &models.ImageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+	return &models.ImageSource{Type: "url", URL: url}
+}
+
+func appendInputMessage(messages []models.InputMessage, role string, blocks []models.ContentBlock) []models.InputMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		existing, err := messages[n-1].Blocks()
+		if err == nil {
+			blocks = append(existing, blocks...)
+			messages = messages[:n-1]
+		}
+	}
+	content, _ := json.Marshal(blocks)
+	return append(messages, models.InputMessage{Role: role, Content: content})
+}
+
+func parseOpenAIStop(raw json.RawMessage) ([]string, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, `"`) {
+		var stop string
+		if err := json.Unmarshal(raw, &stop); err != nil {
+			return nil, fmt.Errorf("%w: stop: %v", ErrInvalidRequest, err)
+		}
+		return []string{stop}, nil
+	}
+	var stop []string
+	if err := json.Unmarshal(raw, &stop); err != nil {
+		return nil, fmt.Errorf("%w: stop: %v", ErrInvalidRequest, err)
+	}
+	return stop, nil
+}
+
+func parseOpenAIToolChoice(raw json.RawMessage) (*models.ToolChoice, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	if strings.HasPrefix(trimmed, `"`) {
+		var choice string
+		_ = json.Unmarshal(raw, &choice)
+		switch choice {
+		case "auto":
+			return &models.ToolChoice{Type: "auto"}, nil
+		case "required":
+			return &models.ToolChoice{Type: "any"}, nil
+		case "none":
+			return &models.ToolChoice{Type: "none"}, nil
+		default:
+			return nil, fmt.Errorf("%w: unsupported tool_choice %q", ErrInvalidRequest, choice)
+		}
+	}
+
+	var choice struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil || choice.Function.Name == "" {
+		return nil, fmt.Errorf("%w: invalid tool_choice", ErrInvalidRequest)
+	}
+	return &models.ToolChoice{Type: "tool", Name: choice.Function.Name}, nil
+}
@@ -0,0 +1,88 @@
+package adapter_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/adapter"
+)
+
+func TestOpenAIRequestToMessages(t *testing.T) {
+	body := []byte(`{
+		"model": "sonnet",
+		"max_completion_tokens": 64,
+		"stop": "END",
+		"stream": true,
+		"stream_options": {"include_usage": true},
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": [{"type":"text","text":"what is this"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"q\":\"x\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "result"},
+			{"role": "user", "content": "thanks"}
+		],
+		"tools": [{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}],
+		"tool_choice": "required"
+	}`)
+
+	payload, opts, err := adapter.OpenAIRequestToMessages(body)
+	if err != nil {
+		t.Fatalf("convert request: %v", err)
+	}
+	if opts.Model != "sonnet" || !opts.Stream || !opts.IncludeUsage {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	raw, _ := json.Marshal(payload)
+	var req struct {
+		System        string   `json:"system"`
+		MaxTokens     int      `json:"max_tokens"`
+		StopSequences []string `json:"stop_sequences"`
+		ToolChoice    struct {
+			Type string `json:"type"`
+		} `json:"tool_choice"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Type      string `json:"type"`
+				ToolUseID string `json:"tool_use_id"`
+				Source    struct {
+					MediaType string `json:"media_type"`
+				} `json:"source"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		t.Fatalf("decode converted payload: %v", err)
+	}
+
+	if req.System != "be brief" || req.MaxTokens != 64 || len(req.StopSequences) != 1 || req.ToolChoice.Type != "any" {
+		t.Fatalf("unexpected request: %s", string(raw))
+	}
+	if len(req.Messages) != 3 {
+		t.Fatalf("messages = %d, want 3: %s", len(req.Messages), string(raw))
+	}
+	if req.Messages[0].Content[1].Source.MediaType != "image/png" {
+		t.Fatalf("image not converted: %s", string(raw))
+	}
+	last := req.Messages[2]
+	if last.Role != "user" || last.Content[0].Type != "tool_result" || last.Content[0].ToolUseID != "call_1" || last.Content[1].Type != "text" {
+		t.Fatalf("tool result should merge with following user message: %s", string(raw))
+	}
+}
+
+func TestMessageToOpenAIResponse(t *testing.T) {
+	body := []byte(`{"id":"msg_1","type":"message","role":"assistant","model":"glm","content":[{"type":"text","text":"hi"},{"type":"tool_use","id":"toolu_1","name":"lookup","input":{"q":"x"}}],"stop_reason":"tool_use","usage":{"input_tokens":5,"output_tokens":3}}`)
+
+	out, err := adapter.MessageToOpenAIResponse(body, "sonnet")
+	if err != nil {
+		t.Fatalf("convert response: %v", err)
+	}
+	got := string(out)
+	for _, want := range []string{`"object":"chat.completion"`, `"model":"sonnet"`, `"content":"hi"`, `"finish_reason":"tool_calls"`, `"arguments":"{\"q\":\"x\"}"`, `"total_tokens":8`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("response missing %s: %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package adapter
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"anthropic-gateway/internal/sse"
+)
+
+type openAIStreamChunk struct {
+	openAIChatResponse
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
+}
+
+type openAIStreamState struct {
+	reader     *sse.Reader
+	builder    *streamBuilder
+	toolBlocks map[int]int
+	sawFinish  bool
+}
+
+func (a *OpenAIAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	state := &openAIStreamState{
+		reader:     sse.NewReader(body),
+		builder:    &streamBuilder{},
+		toolBlocks: make(map[int]int),
+	}
+	return newTranslatingStream(body, state.builder, state.step)
+}
+
+func (s *openAIStreamState) step() error {
+	event, err := s.reader.Next()
+	if err != nil {
+		if err == io.EOF && s.sawFinish {
+			s.builder.finish()
+		}
+		return err
+	}
+
+	data := strings.TrimSpace(string(event.Data))
+	if data == "" {
+		return nil
+	}
+	if data == "[DONE]" {
+		s.builder.finish()
+		return nil
+	}
+
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		s.builder.fail("api_error", "invalid upstream stream chunk")
+		return nil
+	}
+	if chunk.Error != nil {
+		message := chunk.Error.Message
+		if message == "" {
+			message = "upstream stream error"
+		}
+		s.builder.fail("api_error", message)
+		return nil
+	}
+
+	s.builder.start(chunk.ID, chunk.Model)
+	if chunk.Usage != nil {
+		s.builder.usage = fromOpenAIUsage(chunk.Usage)
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if delta := choice.Delta; delta != nil {
+			s.builder.text(openAIContentText(delta.Content))
+			for _, call := range delta.ToolCalls {
+				index := 0
+				if call.Index != nil {
+					index = *call.Index
+				}
+				block, ok := s.toolBlocks[index]
+				if !ok {
+					block = s.builder.parallelToolUse(call.ID, call.Function.Name)
+					s.toolBlocks[index] = block
+				}
+				s.builder.toolInputAt(block, call.Function.Arguments)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.sawFinish = true
+			s.builder.stopReason = openAIStopReason(*choice.FinishReason)
+		}
+	}
+	return nil
+}
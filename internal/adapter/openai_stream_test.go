@@ -0,0 +1,142 @@
+package adapter_test
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/adapter"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+func TestOpenAITranslateStreamToolUse(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/openai_tool_stream.txt")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	events := translateOpenAIStream(t, string(fixture))
+
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.Type)
+	}
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v", names)
+	}
+
+	if got := events[5].ContentBlock; got.Type != "tool_use" || got.ID != "call_1" || got.Name != "get_weather" {
+		t.Fatalf("tool block = %+v", got)
+	}
+	if got := events[6].Delta.PartialJSON + events[7].Delta.PartialJSON; got != `{"city":"Paris"}` {
+		t.Fatalf("tool input = %q", got)
+	}
+	delta := events[9]
+	if *delta.Delta.StopReason != "tool_use" || delta.Usage.InputTokens != 12 || delta.Usage.OutputTokens != 9 {
+		t.Fatalf("message_delta = %+v usage=%+v", delta.Delta, delta.Usage)
+	}
+}
+
+func TestOpenAITranslateStreamInterleavedToolCalls(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/openai_parallel_tool_stream.txt")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	inputs := map[int]string{}
+	blocks := map[int]string{}
+	stopped := map[int]bool{}
+	for _, ev := range translateOpenAIStream(t, string(fixture)) {
+		switch ev.Type {
+		case "content_block_start":
+			blocks[ev.Index] = ev.ContentBlock.ID
+		case "content_block_delta":
+			if stopped[ev.Index] {
+				t.Fatalf("delta for block %d after content_block_stop", ev.Index)
+			}
+			inputs[ev.Index] += ev.Delta.PartialJSON
+		case "content_block_stop":
+			stopped[ev.Index] = true
+		}
+	}
+	if blocks[0] != "call_a" || blocks[1] != "call_b" {
+		t.Fatalf("blocks = %v", blocks)
+	}
+	if inputs[0] != `{"city":"Paris"}` || inputs[1] != `{"zone":"CET"}` {
+		t.Fatalf("inputs = %v", inputs)
+	}
+	if !stopped[0] || !stopped[1] {
+		t.Fatalf("blocks not closed: %v", stopped)
+	}
+}
+
+func TestOpenAITranslateStreamEndsEarly(t *testing.T) {
+	events := translateOpenAIStream(t, `data: {"id":"c1","model":"m","choices":[{"index":0,"delta":{"content":"Hel"}}]}
+
+`)
+	last := events[len(events)-1]
+	if last.Type != "error" || last.Error == nil || last.Error.Type != "api_error" {
+		t.Fatalf("expected trailing error event, got %+v", last)
+	}
+	if events[len(events)-2].Type != "content_block_stop" {
+		t.Fatalf("open block should be closed before error, got %s", events[len(events)-2].Type)
+	}
+}
+
+func TestOpenAITranslateStreamErrorChunk(t *testing.T) {
+	events := translateOpenAIStream(t, `data: {"error":{"message":"model crashed","type":"server_error"}}
+
+data: [DONE]
+
+`)
+	if len(events) != 1 || events[0].Type != "error" || events[0].Error.Message != "model crashed" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func translateOpenAIStream(t *testing.T, upstream string) []models.StreamEvent {
+	t.Helper()
+	return translateStream(t, adapter.NewOpenAIAdapter(), upstream)
+}
+
+func translateStream(t *testing.T, ad adapter.Adapter, upstream string) []models.StreamEvent {
+	t.Helper()
+
+	stream := ad.TranslateStream(io.NopCloser(strings.NewReader(upstream)))
+	defer stream.Close()
+	return decodeStreamEvents(t, stream)
+}
+
+func decodeStreamEvents(t *testing.T, stream io.Reader) []models.StreamEvent {
+	t.Helper()
+
+	reader := sse.NewReader(stream)
+	var events []models.StreamEvent
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read translated stream: %v", err)
+		}
+		var decoded models.StreamEvent
+		if err := json.Unmarshal(ev.Data, &decoded); err != nil {
+			t.Fatalf("decode event %q: %v", string(ev.Data), err)
+		}
+		if decoded.Type != ev.Name {
+			t.Fatalf("event name %q does not match type %q", ev.Name, decoded.Type)
+		}
+		events = append(events, decoded)
+	}
+	return events
+}
@@ -0,0 +1,175 @@
+package adapter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/adapter"
+)
+
+func TestOpenAITranslateRequest(t *testing.T) {
+	ad := adapter.NewOpenAIAdapter()
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"model": "qwen3",
+		"max_tokens": 256,
+		"temperature": 0.2,
+		"stop_sequences": ["END"],
+		"system": [{"type":"text","text":"be brief"}],
+		"tools": [{"name":"get_weather","description":"weather","input_schema":{"type":"object"}}],
+		"tool_choice": {"type":"tool","name":"get_weather"},
+		"messages": [
+			{"role":"user","content":[
+				{"type":"text","text":"look"},
+				{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAAA"}}
+			]},
+			{"role":"assistant","content":[
+				{"type":"text","text":"checking"},
+				{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}}
+			]},
+			{"role":"user","content":[
+				{"type":"tool_result","tool_use_id":"call_1","content":[{"type":"text","text":"sunny"}]},
+				{"type":"text","text":"thanks"}
+			]}
+		]
+	}`), &payload); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+
+	req, err := ad.TranslateRequest("/v1/messages", payload)
+	if err != nil {
+		t.Fatalf("translate request: %v", err)
+	}
+	if req.Path != "/v1/chat/completions" {
+		t.Fatalf("path = %q", req.Path)
+	}
+
+	var out struct {
+		Model      string   `json:"model"`
+		MaxTokens  int      `json:"max_tokens"`
+		Stop       []string `json:"stop"`
+		ToolChoice struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tool_choice"`
+		Tools []struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+		Messages []struct {
+			Role       string          `json:"role"`
+			Content    json.RawMessage `json:"content"`
+			ToolCallID string          `json:"tool_call_id"`
+			ToolCalls  []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(req.Body, &out); err != nil {
+		t.Fatalf("unmarshal translated body: %v", err)
+	}
+
+	if out.Model != "qwen3" || out.MaxTokens != 256 || len(out.Stop) != 1 {
+		t.Fatalf("unexpected scalar fields: %+v", out)
+	}
+	if len(out.Tools) != 1 || out.ToolChoice.Function.Name != "get_weather" {
+		t.Fatalf("unexpected tools: %s", string(req.Body))
+	}
+
+	roles := make([]string, 0, len(out.Messages))
+	for _, msg := range out.Messages {
+		roles = append(roles, msg.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool,user" {
+		t.Fatalf("roles = %s", got)
+	}
+	if !strings.Contains(string(out.Messages[1].Content), "data:image/png;base64,AAAA") {
+		t.Fatalf("image not translated: %s", string(out.Messages[1].Content))
+	}
+	call := out.Messages[2].ToolCalls
+	if len(call) != 1 || call[0].ID != "call_1" || call[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("unexpected tool calls: %+v", call)
+	}
+	if out.Messages[3].ToolCallID != "call_1" || string(out.Messages[3].Content) != `"sunny"` {
+		t.Fatalf("unexpected tool message: %+v", out.Messages[3])
+	}
+}
+
+func TestOpenAITranslateRequestRejectsCountTokens(t *testing.T) {
+	ad := adapter.NewOpenAIAdapter()
+	_, err := ad.TranslateRequest("/v1/messages/count_tokens", map[string]any{"model": "qwen3"})
+	if !errors.Is(err, adapter.ErrUnsupportedPath) {
+		t.Fatalf("expected ErrUnsupportedPath, got %v", err)
+	}
+}
+
+func TestOpenAITranslateResponse(t *testing.T) {
+	ad := adapter.NewOpenAIAdapter()
+	body := []byte(`{
+		"id": "chatcmpl-1",
+		"model": "qwen3",
+		"choices": [{
+			"index": 0,
+			"message": {
+				"role": "assistant",
+				"content": "let me check",
+				"tool_calls": [{"id":"call_9","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]
+			},
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens": 30, "completion_tokens": 7, "prompt_tokens_details": {"cached_tokens": 10}}
+	}`)
+
+	translated, err := ad.TranslateResponse(body)
+	if err != nil {
+		t.Fatalf("translate response: %v", err)
+	}
+
+	var msg struct {
+		Type       string `json:"type"`
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			ID    string          `json:"id"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens          int `json:"input_tokens"`
+			OutputTokens         int `json:"output_tokens"`
+			CacheReadInputTokens int `json:"cache_read_input_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(translated, &msg); err != nil {
+		t.Fatalf("unmarshal message: %v", err)
+	}
+	if msg.Type != "message" || msg.StopReason != "tool_use" {
+		t.Fatalf("unexpected message: %s", string(translated))
+	}
+	if len(msg.Content) != 2 || msg.Content[0].Text != "let me check" || msg.Content[1].ID != "call_9" {
+		t.Fatalf("unexpected content: %s", string(translated))
+	}
+	if string(msg.Content[1].Input) != `{"city":"Paris"}` {
+		t.Fatalf("tool input = %s", string(msg.Content[1].Input))
+	}
+	if msg.Usage.InputTokens != 20 || msg.Usage.OutputTokens != 7 || msg.Usage.CacheReadInputTokens != 10 {
+		t.Fatalf("unexpected usage: %+v", msg.Usage)
+	}
+}
+
+func TestOpenAINormalizeUpstreamError(t *testing.T) {
+	ad := adapter.NewOpenAIAdapter()
+	normalized := ad.NormalizeUpstreamError(http.StatusTooManyRequests, []byte(`{"error":{"message":"slow down","type":"rate_limit"}}`), "req-1")
+	if !strings.Contains(string(normalized), `"rate_limit_error"`) || !strings.Contains(string(normalized), "slow down") {
+		t.Fatalf("unexpected normalized error: %s", string(normalized))
+	}
+}
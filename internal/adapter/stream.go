@@ -0,0 +1,197 @@
+package adapter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+type streamBuilder struct {
+	buf          bytes.Buffer
+	started      bool
+	finished     bool
+	blockOpen    bool
+	blockType    string
+	blockIndex   int
+	nextIndex    int
+	heldTools    []int
+	stopReason   string
+	stopSequence *string
+	usage        models.Usage
+}
+
+func (b *streamBuilder) emit(event models.StreamEvent) {
+	encoded, err := sse.EncodeJSON(event.Type, event)
+	if err != nil {
+		return
+	}
+	b.buf.Write(encoded)
+}
+
+func (b *streamBuilder) start(id, model string) {
+	if b.started {
+		return
+	}
+	b.started = true
+	b.emit(models.StreamEvent{
+		Type: models.EventMessageStart,
+		Message: &models.Message{
+			ID:      id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   model,
+			Content: []models.ContentBlock{},
+			Usage:   b.usage,
+		},
+	})
+}
+
+func (b *streamBuilder) openBlock(block models.ContentBlock) {
+	b.closeBlock()
+	b.startBlock(block)
+}
+
+func (b *streamBuilder) startBlock(block models.ContentBlock) {
+	if block.Type == "tool_use" {
+		block.Input = nil
+	}
+	b.blockOpen = true
+	b.blockType = block.Type
+	b.blockIndex = b.nextIndex
+	b.nextIndex++
+	b.emit(models.StreamEvent{Type: models.EventContentBlockStart, Index: b.blockIndex, ContentBlock: &block})
+}
+
+func (b *streamBuilder) closeBlock() {
+	for _, index := range b.heldTools {
+		b.emit(models.StreamEvent{Type: models.EventContentBlockStop, Index: index})
+	}
+	b.heldTools = b.heldTools[:0]
+	if !b.blockOpen {
+		return
+	}
+	b.blockOpen = false
+	b.emit(models.StreamEvent{Type: models.EventContentBlockStop, Index: b.blockIndex})
+}
+
+func (b *streamBuilder) text(text string) {
+	if text == "" {
+		return
+	}
+	if !b.blockOpen || b.blockType != "text" {
+		b.openBlock(models.ContentBlock{Type: "text"})
+	}
+	b.emit(models.StreamEvent{
+		Type:  models.EventContentBlockDelta,
+		Index: b.blockIndex,
+		Delta: &models.StreamDelta{Type: "text_delta", Text: text},
+	})
+}
+
+func (b *streamBuilder) toolUse(id, name string) {
+	b.openBlock(models.ContentBlock{Type: "tool_use", ID: id, Name: name})
+}
+
+func (b *streamBuilder) toolInput(partial string) {
+	if !b.blockOpen || b.blockType != "tool_use" {
+		return
+	}
+	b.toolInputAt(b.blockIndex, partial)
+}
+
+func (b *streamBuilder) parallelToolUse(id, name string) int {
+	if b.blockOpen && b.blockType == "tool_use" {
+		b.heldTools = append(b.heldTools, b.blockIndex)
+		b.blockOpen = false
+	} else {
+		b.closeBlock()
+	}
+	b.startBlock(models.ContentBlock{Type: "tool_use", ID: id, Name: name})
+	return b.blockIndex
+}
+
+func (b *streamBuilder) toolInputAt(index int, partial string) {
+	open := b.blockOpen && b.blockIndex == index || slices.Contains(b.heldTools, index)
+	if partial == "" || !open {
+		return
+	}
+	b.emit(models.StreamEvent{
+		Type:  models.EventContentBlockDelta,
+		Index: index,
+		Delta: &models.StreamDelta{Type: "input_json_delta", PartialJSON: partial},
+	})
+}
+
+func (b *streamBuilder) finish() {
+	if b.finished {
+		return
+	}
+	b.start("", "")
+	b.closeBlock()
+	b.finished = true
+
+	stopReason := b.stopReason
+	if stopReason == "" {
+		stopReason = models.StopReasonEndTurn
+	}
+	usage := b.usage
+	b.emit(models.StreamEvent{
+		Type:  models.EventMessageDelta,
+		Delta: &models.StreamDelta{StopReason: &stopReason, StopSequence: b.stopSequence},
+		Usage: &usage,
+	})
+	b.emit(models.StreamEvent{Type: models.EventMessageStop})
+}
+
+func (b *streamBuilder) fail(errorType, message string) {
+	if b.finished {
+		return
+	}
+	b.closeBlock()
+	b.finished = true
+	b.emit(models.StreamEvent{
+		Type:  models.EventError,
+		Error: &apierrors.Inner{Type: errorType, Message: message},
+	})
+}
+
+type translatingStream struct {
+	src     io.ReadCloser
+	builder *streamBuilder
+	step    func() error
+	done    bool
+}
+
+func newTranslatingStream(src io.ReadCloser, builder *streamBuilder, step func() error) *translatingStream {
+	return &translatingStream{src: src, builder: builder, step: step}
+}
+
+func (t *translatingStream) Read(p []byte) (int, error) {
+	for t.builder.buf.Len() == 0 {
+		if t.done {
+			return 0, io.EOF
+		}
+		if err := t.step(); err != nil {
+			t.done = true
+			if !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+			if !t.builder.finished {
+				t.builder.fail("api_error", "upstream stream ended unexpectedly")
+			}
+		}
+		if t.builder.finished {
+			t.done = true
+		}
+	}
+	return t.builder.buf.Read(p)
+}
+
+func (t *translatingStream) Close() error {
+	return t.src.Close()
+}
@@ -0,0 +1,90 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"anthropic-gateway/internal/models"
+)
+
+const synthesizedChunkSize = 32
+
+func MessageToStream(body []byte) ([]byte, error) {
+	var message models.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, fmt.Errorf("decode message: %w", err)
+	}
+	if message.Type != "" && message.Type != "message" {
+		return nil, fmt.Errorf("decode message: unexpected type %q", message.Type)
+	}
+
+	b := &streamBuilder{}
+	b.usage = message.Usage
+	b.usage.OutputTokens = 0
+	b.start(message.ID, message.Model)
+
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			b.openBlock(models.ContentBlock{Type: "text"})
+			for _, chunk := range chunkString(block.Text) {
+				b.text(chunk)
+			}
+		case "tool_use":
+			b.toolUse(block.ID, block.Name)
+			input := block.Input
+			if len(bytes.TrimSpace(input)) > 0 {
+				var compact bytes.Buffer
+				if json.Compact(&compact, input) == nil {
+					input = compact.Bytes()
+				}
+				for _, chunk := range chunkString(string(input)) {
+					b.toolInput(chunk)
+				}
+			}
+		case "thinking":
+			b.openBlock(models.ContentBlock{Type: "thinking"})
+			for _, chunk := range chunkString(block.Thinking) {
+				b.emit(models.StreamEvent{
+					Type:  models.EventContentBlockDelta,
+					Index: b.blockIndex,
+					Delta: &models.StreamDelta{Type: "thinking_delta", Thinking: chunk},
+				})
+			}
+			if block.Signature != "" {
+				b.emit(models.StreamEvent{
+					Type:  models.EventContentBlockDelta,
+					Index: b.blockIndex,
+					Delta: &models.StreamDelta{Type: "signature_delta", Signature: block.Signature},
+				})
+			}
+		default:
+			b.openBlock(block)
+		}
+	}
+
+	if message.StopReason != nil {
+		b.stopReason = *message.StopReason
+	}
+	b.stopSequence = message.StopSequence
+	b.usage = message.Usage
+	b.finish()
+	return b.buf.Bytes(), nil
+}
+
+func chunkString(s string) []string {
+	var chunks []string
+	for len(s) > 0 {
+		end, runes := 0, 0
+		for end < len(s) && runes < synthesizedChunkSize {
+			_, size := utf8.DecodeRuneInString(s[end:])
+			end += size
+			runes++
+		}
+		chunks = append(chunks, s[:end])
+		s = s[end:]
+	}
+	return chunks
+}
@@ -0,0 +1,88 @@
+package adapter_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/adapter"
+)
+
+func TestMessageToStream(t *testing.T) {
+	longText := strings.Repeat("héllo ", 12)
+	body := `{"id":"msg_1","type":"message","role":"assistant","model":"glm-4.7",
+		"content":[
+			{"type":"thinking","thinking":"let me think","signature":"sig"},
+			{"type":"text","text":"` + longText + `"},
+			{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city": "Paris", "units": "metric", "days": 3}}
+		],
+		"stop_reason":"tool_use","stop_sequence":null,
+		"usage":{"input_tokens":10,"output_tokens":25,"cache_read_input_tokens":4}}`
+
+	synthesized, err := adapter.MessageToStream([]byte(body))
+	if err != nil {
+		t.Fatalf("MessageToStream: %v", err)
+	}
+	events := decodeStreamEvents(t, bytes.NewReader(synthesized))
+
+	start := events[0]
+	if start.Type != "message_start" || start.Message.ID != "msg_1" || start.Message.Model != "glm-4.7" ||
+		start.Message.Usage.InputTokens != 10 || start.Message.Usage.CacheReadInputTokens != 4 || start.Message.Usage.OutputTokens != 0 {
+		t.Fatalf("unexpected message_start: %+v", start.Message)
+	}
+
+	var text, thinking, signature, input strings.Builder
+	textDeltas := 0
+	blockTypes := map[int]string{}
+	for _, ev := range events[1 : len(events)-2] {
+		switch ev.Type {
+		case "content_block_start":
+			blockTypes[ev.Index] = ev.ContentBlock.Type
+			if ev.ContentBlock.Type == "tool_use" && (ev.ContentBlock.ID != "toolu_1" || ev.ContentBlock.Name != "get_weather" || string(ev.ContentBlock.Input) != "{}") {
+				t.Fatalf("unexpected tool_use start: %+v", ev.ContentBlock)
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				text.WriteString(ev.Delta.Text)
+				textDeltas++
+			case "thinking_delta":
+				thinking.WriteString(ev.Delta.Thinking)
+			case "signature_delta":
+				signature.WriteString(ev.Delta.Signature)
+			case "input_json_delta":
+				input.WriteString(ev.Delta.PartialJSON)
+			}
+		case "content_block_stop":
+		default:
+			t.Fatalf("unexpected event %q", ev.Type)
+		}
+	}
+
+	if blockTypes[0] != "thinking" || blockTypes[1] != "text" || blockTypes[2] != "tool_use" {
+		t.Fatalf("block types = %v", blockTypes)
+	}
+	if text.String() != longText || textDeltas < 2 {
+		t.Fatalf("text = %q in %d deltas", text.String(), textDeltas)
+	}
+	if thinking.String() != "let me think" || signature.String() != "sig" {
+		t.Fatalf("thinking = %q, signature = %q", thinking.String(), signature.String())
+	}
+	if input.String() != `{"city":"Paris","units":"metric","days":3}` {
+		t.Fatalf("input = %q", input.String())
+	}
+
+	delta := events[len(events)-2]
+	if delta.Type != "message_delta" || *delta.Delta.StopReason != "tool_use" || delta.Usage.OutputTokens != 25 {
+		t.Fatalf("unexpected message_delta: %+v %+v", delta.Delta, delta.Usage)
+	}
+	if events[len(events)-1].Type != "message_stop" {
+		t.Fatalf("last event = %q", events[len(events)-1].Type)
+	}
+}
+
+func TestMessageToStreamRejectsNonMessage(t *testing.T) {
+	if _, err := adapter.MessageToStream([]byte(`{"type":"error","error":{"type":"api_error","message":"x"}}`)); err == nil {
+		t.Fatalf("expected error for non-message body")
+	}
+}
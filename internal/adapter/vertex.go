@@ -0,0 +1,146 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/google"
+	"anthropic-gateway/internal/models"
+)
+
+const vertexAnthropicVersion = "vertex-2023-10-16"
+
+type VertexAdapter struct {
+	mu      sync.Mutex
+	sources map[string]vertexTokenSource
+}
+
+type vertexTokenSource struct {
+	modTime time.Time
+	size    int64
+	ts      *google.TokenSource
+}
+
+func NewVertexAdapter() *VertexAdapter {
+	return &VertexAdapter{sources: make(map[string]vertexTokenSource)}
+}
+
+func (a *VertexAdapter) BuildUpstreamURL(apiBase, upstreamPath, rawQuery string) (string, error) {
+	return joinURL(apiBase, upstreamPath, rawQuery)
+}
+
+func (a *VertexAdapter) ApplyAuthHeaders(headers http.Header, params config.UpstreamParams) {
+	headers.Del("Authorization")
+	headers.Del("x-api-key")
+	headers.Del("anthropic-version")
+	if params.AuthType == config.AuthTypeBearer {
+		headers.Set("Authorization", "Bearer "+params.APIKey)
+	}
+}
+
+func (a *VertexAdapter) AuthorizeRequest(req *http.Request, params config.UpstreamParams) error {
+	if params.AuthType != config.AuthTypeOAuth {
+		return nil
+	}
+	ts, err := a.tokenSource(params.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamAuth, err)
+	}
+	token, err := ts.Token(req.Context())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamAuth, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *VertexAdapter) tokenSource(credentialsFile string) (*google.TokenSource, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, err := os.Stat(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials_file: %w", err)
+	}
+	if cached, ok := a.sources[credentialsFile]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.ts, nil
+	}
+	keyJSON, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials_file: %w", err)
+	}
+	ts, err := google.NewTokenSource(keyJSON, google.CloudPlatformScope, nil)
+	if err != nil {
+		return nil, err
+	}
+	a.sources[credentialsFile] = vertexTokenSource{modTime: info.ModTime(), size: info.Size(), ts: ts}
+	return ts, nil
+}
+
+func (a *VertexAdapter) BuildModelsResponse(cfg *config.Config) models.ListResponse {
+	return models.BuildListResponse(cfg)
+}
+
+func (a *VertexAdapter) NormalizeUpstreamError(statusCode int, upstreamBody []byte, requestID string) []byte {
+	if apierrors.IsAnthropicErrorPayload(upstreamBody) {
+		return upstreamBody
+	}
+	message := extractMessage(upstreamBody)
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return apierrors.Marshal(errorTypeForStatus(statusCode), message, requestID)
+}
+
+func (a *VertexAdapter) TranslateRequest(upstreamPath string, payload map[string]any) (UpstreamRequest, error) {
+	model, _ := payload["model"].(string)
+	if strings.TrimSpace(model) == "" {
+		return UpstreamRequest{}, fmt.Errorf("%w: model is required", ErrInvalidRequest)
+	}
+
+	switch strings.TrimRight(upstreamPath, "/") {
+	case "/v1/messages":
+		body := make(map[string]any, len(payload)+1)
+		for k, v := range payload {
+			if k != "model" {
+				body[k] = v
+			}
+		}
+		if _, ok := body["anthropic_version"]; !ok {
+			body["anthropic_version"] = vertexAnthropicVersion
+		}
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return UpstreamRequest{}, fmt.Errorf("marshal rawPredict request: %w", err)
+		}
+		method := "rawPredict"
+		if stream, _ := payload["stream"].(bool); stream {
+			method = "streamRawPredict"
+		}
+		return UpstreamRequest{Path: "/publishers/anthropic/models/" + model + ":" + method, Body: encoded}, nil
+	case "/v1/messages/count_tokens":
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return UpstreamRequest{}, fmt.Errorf("marshal count-tokens request: %w", err)
+		}
+		return UpstreamRequest{Path: "/publishers/anthropic/models/count-tokens:rawPredict", Body: encoded}, nil
+	default:
+		return UpstreamRequest{}, ErrUnsupportedPath
+	}
+}
+
+func (a *VertexAdapter) TranslateResponse(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (a *VertexAdapter) TranslateStream(body io.ReadCloser) io.ReadCloser {
+	return body
+}
@@ -0,0 +1,56 @@
+package adapter_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"anthropic-gateway/internal/adapter"
+)
+
+func TestVertexTranslateRequest(t *testing.T) {
+	ad := adapter.NewVertexAdapter()
+	req, err := ad.TranslateRequest("/v1/messages", map[string]any{
+		"model":      "claude-sonnet-4@20250514",
+		"stream":     true,
+		"max_tokens": 64,
+		"messages":   []any{map[string]any{"role": "user", "content": "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("translate request: %v", err)
+	}
+	if req.Path != "/publishers/anthropic/models/claude-sonnet-4@20250514:streamRawPredict" {
+		t.Fatalf("path = %q", req.Path)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if _, ok := body["model"]; ok {
+		t.Fatalf("model should move into the path: %s", req.Body)
+	}
+	if body["anthropic_version"] != "vertex-2023-10-16" || body["stream"] != true {
+		t.Fatalf("unexpected body: %s", req.Body)
+	}
+
+	upstreamURL, err := ad.BuildUpstreamURL("https://us-east5-aiplatform.googleapis.com/v1/projects/p/locations/us-east5", req.Path, "")
+	if err != nil {
+		t.Fatalf("build url: %v", err)
+	}
+	if upstreamURL != "https://us-east5-aiplatform.googleapis.com/v1/projects/p/locations/us-east5/publishers/anthropic/models/claude-sonnet-4@20250514:streamRawPredict" {
+		t.Fatalf("url = %q", upstreamURL)
+	}
+}
+
+func TestVertexTranslateCountTokens(t *testing.T) {
+	req, err := adapter.NewVertexAdapter().TranslateRequest("/v1/messages/count_tokens", map[string]any{
+		"model":    "claude-sonnet-4@20250514",
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("translate request: %v", err)
+	}
+	if req.Path != "/publishers/anthropic/models/count-tokens:rawPredict" {
+		t.Fatalf("path = %q", req.Path)
+	}
+}
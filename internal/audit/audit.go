@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/models"
+)
+
+const (
+	currentFile     = "audit.jsonl"
+	rotatedPrefix   = "audit-"
+	rotatedSuffix   = ".jsonl"
+	rotatedLayout   = "20060102T150405.000000000"
+	bytesPerMB      = 1 << 20
+	filePermissions = 0o600
+)
+
+type Record struct {
+	RequestID      string          `json:"request_id"`
+	Time           time.Time       `json:"time"`
+	KeyName        string          `json:"key_name,omitempty"`
+	Method         string          `json:"method"`
+	Path           string          `json:"path"`
+	RequestedModel string          `json:"requested_model,omitempty"`
+	ModelName      string          `json:"model_name,omitempty"`
+	UpstreamModel  string          `json:"upstream_model,omitempty"`
+	UpstreamURL    string          `json:"upstream_url,omitempty"`
+	Status         int             `json:"status"`
+	LatencyMS      int64           `json:"latency_ms"`
+	Stream         bool            `json:"stream"`
+	Usage          *models.Usage   `json:"usage,omitempty"`
+	RequestBody    json.RawMessage `json:"request_body,omitempty"`
+	ResponseBody   json.RawMessage `json:"response_body,omitempty"`
+	ResponseText   string          `json:"response_text,omitempty"`
+}
+
+type Logger struct {
+	cfg    config.Audit
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func Open(cfg *config.Audit, logger *slog.Logger) (*Logger, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	l := &Logger{cfg: *cfg, logger: logger, now: time.Now}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create audit dir: %w", err)
+	}
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) IncludeBodies() bool {
+	return l != nil && l.cfg.IncludeBodies
+}
+
+func (l *Logger) Write(rec Record) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		l.logger.Error("failed to encode audit record", "error", err, "request_id", rec.RequestID)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.shouldRotate(int64(len(line))) {
+		if err := l.rotate(); err != nil {
+			l.logger.Error("failed to rotate audit log", "error", err, "dir", l.cfg.Dir)
+			if l.file == nil {
+				return
+			}
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		l.logger.Error("failed to write audit record", "error", err, "request_id", rec.RequestID)
+	}
+}
+
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Logger) shouldRotate(next int64) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.cfg.MaxSizeMB > 0 && l.size+next > int64(l.cfg.MaxSizeMB)*bytesPerMB {
+		return true
+	}
+	return l.cfg.MaxAge > 0 && l.now().Sub(l.opened) >= l.cfg.MaxAge
+}
+
+func (l *Logger) openFile() error {
+	f, err := os.OpenFile(filepath.Join(l.cfg.Dir, currentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePermissions)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	l.opened = l.now()
+	return nil
+}
+
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	rotated := rotatedPrefix + l.now().UTC().Format(rotatedLayout) + rotatedSuffix
+	if err := os.Rename(filepath.Join(l.cfg.Dir, currentFile), filepath.Join(l.cfg.Dir, rotated)); err != nil {
+		if openErr := l.openFile(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := l.openFile(); err != nil {
+		return err
+	}
+	return l.prune()
+}
+
+func (l *Logger) prune() error {
+	entries, err := os.ReadDir(l.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	var rotated []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, rotatedPrefix) && strings.HasSuffix(name, rotatedSuffix) {
+			rotated = append(rotated, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+
+	now := l.now()
+	for i, name := range rotated {
+		expired := l.cfg.MaxFiles > 0 && i >= l.cfg.MaxFiles
+		if !expired && l.cfg.Retention > 0 {
+			stamp := strings.TrimSuffix(strings.TrimPrefix(name, rotatedPrefix), rotatedSuffix)
+			if at, err := time.Parse(rotatedLayout, stamp); err == nil && now.Sub(at) > l.cfg.Retention {
+				expired = true
+			}
+		}
+		if !expired {
+			continue
+		}
+		if err := os.Remove(filepath.Join(l.cfg.Dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
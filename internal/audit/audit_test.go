@@ -0,0 +1,113 @@
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"anthropic-gateway/internal/audit"
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/models"
+)
+
+func TestLoggerWritesJSONLines(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := audit.Open(&config.Audit{Dir: dir, MaxSizeMB: 1, MaxFiles: 2}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	logger.Write(audit.Record{RequestID: "req-1", Status: 200, Usage: &models.Usage{InputTokens: 3, OutputTokens: 4}})
+	logger.Write(audit.Record{RequestID: "req-2", Status: 429})
+	if err := logger.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	records := readRecords(t, filepath.Join(dir, "audit.jsonl"))
+	if len(records) != 2 || records[0].RequestID != "req-1" || records[1].Status != 429 {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if records[0].Usage == nil || records[0].Usage.OutputTokens != 4 {
+		t.Fatalf("unexpected usage: %+v", records[0].Usage)
+	}
+}
+
+func TestLoggerRotatesBySizeAndKeepsMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := audit.Open(&config.Audit{Dir: dir, MaxSizeMB: 1, MaxFiles: 2}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer logger.Close()
+
+	big := strings.Repeat("x", 700*1024)
+	for i := 0; i < 5; i++ {
+		logger.Write(audit.Record{RequestID: "req", ResponseText: big})
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %v", rotated)
+	}
+	if records := readRecords(t, filepath.Join(dir, "audit.jsonl")); len(records) != 1 {
+		t.Fatalf("current file records = %d", len(records))
+	}
+}
+
+func TestLoggerRotatesByAgeAndDropsExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "audit-"+time.Now().Add(-48*time.Hour).UTC().Format("20060102T150405.000000000")+".jsonl")
+	if err := os.WriteFile(stale, []byte("{}\n"), 0o600); err != nil {
+		t.Fatalf("write stale: %v", err)
+	}
+
+	logger, err := audit.Open(&config.Audit{Dir: dir, MaxAge: time.Nanosecond, Retention: 24 * time.Hour}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Write(audit.Record{RequestID: "req-1"})
+	time.Sleep(time.Millisecond)
+	logger.Write(audit.Record{RequestID: "req-2"})
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected stale file to be removed, got %v", err)
+	}
+	rotated, _ := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files = %v", rotated)
+	}
+	if records := readRecords(t, rotated[0]); len(records) != 1 || records[0].RequestID != "req-1" {
+		t.Fatalf("unexpected rotated records: %+v", records)
+	}
+}
+
+func readRecords(t *testing.T, path string) []audit.Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var records []audit.Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var rec audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("decode line: %v", err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
@@ -0,0 +1,137 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+const (
+	preludeLen  = 12
+	maxFrameLen = 16 << 20
+)
+
+var ErrInvalidFrame = errors.New("invalid event-stream frame")
+
+type Message struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+type EventStreamReader struct {
+	r io.Reader
+}
+
+func NewEventStreamReader(r io.Reader) *EventStreamReader {
+	return &EventStreamReader{r: r}
+}
+
+func (d *EventStreamReader) Next() (Message, error) {
+	prelude := make([]byte, preludeLen)
+	if _, err := io.ReadFull(d.r, prelude); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Message{}, fmt.Errorf("%w: truncated prelude", ErrInvalidFrame)
+		}
+		return Message{}, err
+	}
+
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return Message{}, fmt.Errorf("%w: prelude checksum mismatch", ErrInvalidFrame)
+	}
+	if totalLen < preludeLen+4+headersLen || totalLen > maxFrameLen {
+		return Message{}, fmt.Errorf("%w: bad length %d", ErrInvalidFrame, totalLen)
+	}
+
+	frame := make([]byte, totalLen)
+	copy(frame, prelude)
+	if _, err := io.ReadFull(d.r, frame[preludeLen:]); err != nil {
+		return Message{}, fmt.Errorf("%w: truncated message", ErrInvalidFrame)
+	}
+	if crc32.ChecksumIEEE(frame[:totalLen-4]) != binary.BigEndian.Uint32(frame[totalLen-4:]) {
+		return Message{}, fmt.Errorf("%w: message checksum mismatch", ErrInvalidFrame)
+	}
+
+	headers, err := decodeHeaders(frame[preludeLen : preludeLen+headersLen])
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Headers: headers, Payload: frame[preludeLen+headersLen : totalLen-4]}, nil
+}
+
+func decodeHeaders(data []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		if len(data) < 1+nameLen+1 {
+			return nil, fmt.Errorf("%w: truncated header", ErrInvalidFrame)
+		}
+		name := string(data[1 : 1+nameLen])
+		valueType := data[1+nameLen]
+		data = data[2+nameLen:]
+
+		var size int
+		switch valueType {
+		case 0, 1:
+			size = 0
+		case 2:
+			size = 1
+		case 3:
+			size = 2
+		case 4:
+			size = 4
+		case 5, 8:
+			size = 8
+		case 9:
+			size = 16
+		case 6, 7:
+			if len(data) < 2 {
+				return nil, fmt.Errorf("%w: truncated header", ErrInvalidFrame)
+			}
+			size = int(binary.BigEndian.Uint16(data[0:2]))
+			data = data[2:]
+		default:
+			return nil, fmt.Errorf("%w: unknown header type %d", ErrInvalidFrame, valueType)
+		}
+		if len(data) < size {
+			return nil, fmt.Errorf("%w: truncated header", ErrInvalidFrame)
+		}
+		if valueType == 7 {
+			headers[name] = string(data[:size])
+		}
+		data = data[size:]
+	}
+	return headers, nil
+}
+
+func EncodeMessage(headers map[string]string, payload []byte) []byte {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var hdr bytes.Buffer
+	for _, name := range names {
+		hdr.WriteByte(byte(len(name)))
+		hdr.WriteString(name)
+		hdr.WriteByte(7)
+		_ = binary.Write(&hdr, binary.BigEndian, uint16(len(headers[name])))
+		hdr.WriteString(headers[name])
+	}
+
+	totalLen := preludeLen + hdr.Len() + len(payload) + 4
+	frame := make([]byte, 0, totalLen)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(totalLen))
+	frame = binary.BigEndian.AppendUint32(frame, uint32(hdr.Len()))
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+	frame = append(frame, hdr.Bytes()...)
+	frame = append(frame, payload...)
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+	return frame
+}
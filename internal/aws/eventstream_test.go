@@ -0,0 +1,45 @@
+package aws_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"anthropic-gateway/internal/aws"
+)
+
+func TestEventStreamReaderDecodesFrames(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(aws.EncodeMessage(map[string]string{":message-type": "event", ":event-type": "chunk"}, []byte(`{"bytes":"e30="}`)))
+	stream.Write(aws.EncodeMessage(map[string]string{":message-type": "exception", ":exception-type": "throttlingException"}, []byte(`{"message":"slow down"}`)))
+
+	reader := aws.NewEventStreamReader(&stream)
+	first, err := reader.Next()
+	if err != nil {
+		t.Fatalf("first frame: %v", err)
+	}
+	if first.Headers[":event-type"] != "chunk" || string(first.Payload) != `{"bytes":"e30="}` {
+		t.Fatalf("first = %+v", first)
+	}
+	second, err := reader.Next()
+	if err != nil {
+		t.Fatalf("second frame: %v", err)
+	}
+	if second.Headers[":exception-type"] != "throttlingException" || string(second.Payload) != `{"message":"slow down"}` {
+		t.Fatalf("second = %+v", second)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestEventStreamReaderRejectsCorruptFrame(t *testing.T) {
+	frame := aws.EncodeMessage(map[string]string{":event-type": "chunk"}, []byte("payload"))
+	frame[len(frame)-6] ^= 0xff
+
+	_, err := aws.NewEventStreamReader(bytes.NewReader(frame)).Next()
+	if !errors.Is(err, aws.ErrInvalidFrame) {
+		t.Fatalf("expected ErrInvalidFrame, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package aws_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"anthropic-gateway/internal/aws"
+)
+
+var (
+	testCreds = aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	testTime  = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSignRequestGetVanilla(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+
+	if err := aws.SignRequest(req, nil, testCreds, "us-east-1", "service", testTime); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("authorization =\n%s\nwant\n%s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Fatalf("x-amz-date = %q", got)
+	}
+}
+
+func TestSignRequestIAMListUsers(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("User-Agent", "not-signed")
+
+	if err := aws.SignRequest(req, nil, testCreds, "us-east-1", "iam", testTime); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSignRequestSessionToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://bedrock-runtime.us-east-1.amazonaws.com/model/anthropic.claude-v2%3A1/invoke", strings.NewReader("{}"))
+	creds := testCreds
+	creds.SessionToken = "session"
+
+	if err := aws.SignRequest(req, []byte("{}"), creds, "us-east-1", "bedrock", testTime); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if req.Header.Get("X-Amz-Security-Token") != "session" {
+		t.Fatalf("missing session token header")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Fatalf("authorization = %q", req.Header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+)
+
+const fileSuffix = ".json"
+
+type Entry struct {
+	Status   int       `json:"status"`
+	Body     []byte    `json:"body"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	dir        string
+	logger     *slog.Logger
+	now        func() time.Time
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+
+	ioMu sync.Mutex
+}
+
+type item struct {
+	key   string
+	entry Entry
+}
+
+type fileOp struct {
+	key  string
+	data []byte
+}
+
+func Open(cfg *config.Cache, logger *slog.Logger) (*Cache, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	c := &Cache{
+		ttl:        cfg.TTL,
+		maxEntries: cfg.MaxEntries,
+		dir:        cfg.Dir,
+		logger:     logger,
+		now:        time.Now,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+	if c.dir == "" {
+		return c, nil
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cache) Get(key string) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+	c.mu.Lock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		return Entry{}, false
+	}
+	it := el.Value.(*item)
+	if c.expired(it.entry) {
+		c.unlockAndSync([]fileOp{{key: c.remove(el)}})
+		return Entry{}, false
+	}
+	c.order.MoveToFront(el)
+	entry := it.entry
+	c.mu.Unlock()
+	return entry, true
+}
+
+func (c *Cache) Set(key string, entry Entry) {
+	if c == nil {
+		return
+	}
+	entry.StoredAt = c.now()
+
+	var ops []fileOp
+	if c.dir != "" {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			c.logger.Warn("failed to encode cache entry", "error", err, "key", key)
+		} else {
+			ops = append(ops, fileOp{key: key, data: data})
+		}
+	}
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*item).entry = entry
+		c.order.MoveToFront(el)
+	} else {
+		c.items[key] = c.order.PushFront(&item{key: key, entry: entry})
+	}
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		ops = append(ops, fileOp{key: c.remove(c.order.Back())})
+	}
+	c.unlockAndSync(ops)
+}
+
+func (c *Cache) expired(entry Entry) bool {
+	return c.ttl > 0 && c.now().Sub(entry.StoredAt) >= c.ttl
+}
+
+func (c *Cache) remove(el *list.Element) string {
+	it := c.order.Remove(el).(*item)
+	delete(c.items, it.key)
+	return it.key
+}
+
+func (c *Cache) unlockAndSync(ops []fileOp) {
+	if c.dir == "" || len(ops) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.ioMu.Lock()
+	c.mu.Unlock()
+	defer c.ioMu.Unlock()
+
+	for _, op := range ops {
+		if op.data == nil {
+			c.removeFile(op.key)
+		} else {
+			c.writeFile(op.key, op.data)
+		}
+	}
+}
+
+func (c *Cache) writeFile(key string, data []byte) {
+	tmp := c.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		c.logger.Warn("failed to write cache file", "error", err, "key", key)
+		return
+	}
+	if err := os.Rename(tmp, c.path(key)); err != nil {
+		os.Remove(tmp)
+		c.logger.Warn("failed to write cache file", "error", err, "key", key)
+	}
+}
+
+func (c *Cache) removeFile(key string) {
+	if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.logger.Warn("failed to remove cache file", "error", err, "key", key)
+	}
+}
+
+func (c *Cache) load() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("read cache dir: %w", err)
+	}
+
+	type stored struct {
+		key   string
+		entry Entry
+	}
+	var entries []stored
+	for _, file := range files {
+		name := file.Name()
+		if !file.Type().IsRegular() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		key := strings.TrimSuffix(name, fileSuffix)
+		data, err := os.ReadFile(filepath.Join(c.dir, name))
+		if err != nil {
+			return fmt.Errorf("read cache file: %w", err)
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil || c.expired(entry) {
+			os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+		entries = append(entries, stored{key: key, entry: entry})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].entry.StoredAt.Before(entries[j].entry.StoredAt) })
+	for _, e := range entries {
+		c.items[e.key] = c.order.PushFront(&item{key: e.key, entry: e.entry})
+	}
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.removeFile(c.remove(c.order.Back()))
+	}
+	return nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+fileSuffix)
+}
@@ -0,0 +1,113 @@
+package cache_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"anthropic-gateway/internal/cache"
+	"anthropic-gateway/internal/config"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, err := cache.Open(&config.Cache{TTL: time.Hour, MaxEntries: 2}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	c.Set("a", cache.Entry{Status: 200, Body: []byte("a")})
+	c.Set("b", cache.Entry{Status: 200, Body: []byte("b")})
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("expected a")
+	}
+	c.Set("c", cache.Entry{Status: 200, Body: []byte("c")})
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if entry, ok := c.Get(key); !ok || string(entry.Body) != key {
+			t.Fatalf("Get(%q) = %+v, %v", key, entry, ok)
+		}
+	}
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	c, err := cache.Open(&config.Cache{TTL: 10 * time.Millisecond, MaxEntries: 10}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	c.Set("a", cache.Entry{Status: 200, Body: []byte("a")})
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("expected a to expire")
+	}
+}
+
+func TestCachePersistsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Cache{TTL: time.Hour, MaxEntries: 2, Dir: dir}
+
+	c, err := cache.Open(cfg, logger)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	c.Set("a", cache.Entry{Status: 200, Body: []byte(`{"id":"a"}`)})
+	c.Set("b", cache.Entry{Status: 200, Body: []byte(`{"id":"b"}`)})
+	c.Set("c", cache.Entry{Status: 200, Body: []byte(`{"id":"c"}`)})
+	if _, err := os.Stat(filepath.Join(dir, "a.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected evicted entry file to be removed, got %v", err)
+	}
+
+	reopened, err := cache.Open(cfg, logger)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	entry, ok := reopened.Get("c")
+	if !ok || entry.Status != 200 || string(entry.Body) != `{"id":"c"}` {
+		t.Fatalf("Get(c) = %+v, %v", entry, ok)
+	}
+	if _, ok := reopened.Get("b"); !ok {
+		t.Fatalf("expected b after reopen")
+	}
+}
+
+func TestCacheConcurrentSetsKeepDiskInSync(t *testing.T) {
+	dir := t.TempDir()
+	c, err := cache.Open(&config.Cache{TTL: time.Hour, MaxEntries: 4, Dir: dir}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				key := fmt.Sprintf("k%d", (i*50+j)%12)
+				c.Set(key, cache.Entry{Status: 200, Body: []byte(key)})
+				c.Get(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 4 {
+		t.Fatalf("cache files = %d, want 4", len(files))
+	}
+	for _, file := range files {
+		key := strings.TrimSuffix(filepath.Base(file), ".json")
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("file %s has no cache entry", file)
+		}
+	}
+}
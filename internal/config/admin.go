@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Admin struct {
+	Key string `yaml:"key"`
+}
+
+func (c *Config) AdminKey() string {
+	if c.Admin == nil {
+		return ""
+	}
+	return c.Admin.Key
+}
+
+func (c *Config) validateAdmin() error {
+	if c.Admin == nil {
+		return nil
+	}
+	c.Admin.Key = strings.TrimSpace(c.Admin.Key)
+	if c.Admin.Key == "" {
+		return fmt.Errorf("admin.key is required")
+	}
+	if _, exists := c.keyIndex[c.Admin.Key]; exists {
+		return fmt.Errorf("admin.key must not match a virtual key")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditMaxSizeMB = 100
+	defaultAuditMaxAge    = 24 * time.Hour
+	defaultAuditMaxFiles  = 10
+)
+
+type Audit struct {
+	Dir           string        `yaml:"dir"`
+	MaxSizeMB     int           `yaml:"max_size_mb"`
+	MaxAge        time.Duration `yaml:"max_age"`
+	MaxFiles      int           `yaml:"max_files"`
+	Retention     time.Duration `yaml:"retention"`
+	IncludeBodies bool          `yaml:"include_bodies"`
+}
+
+func (c *Config) applyAuditDefaults() {
+	if c.Audit == nil {
+		return
+	}
+	if c.Audit.MaxSizeMB == 0 {
+		c.Audit.MaxSizeMB = defaultAuditMaxSizeMB
+	}
+	if c.Audit.MaxAge == 0 {
+		c.Audit.MaxAge = defaultAuditMaxAge
+	}
+	if c.Audit.MaxFiles == 0 {
+		c.Audit.MaxFiles = defaultAuditMaxFiles
+	}
+}
+
+func validateAudit(a *Audit) error {
+	if a == nil {
+		return nil
+	}
+	if strings.TrimSpace(a.Dir) == "" {
+		return fmt.Errorf("audit.dir is required")
+	}
+	if a.MaxSizeMB < 0 || a.MaxFiles < 0 {
+		return fmt.Errorf("audit.max_size_mb and audit.max_files must not be negative")
+	}
+	if a.MaxAge < 0 || a.Retention < 0 {
+		return fmt.Errorf("audit durations must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultCacheTTL        = time.Hour
+	defaultCacheMaxEntries = 1000
+)
+
+type Cache struct {
+	TTL        time.Duration `yaml:"ttl"`
+	MaxEntries int           `yaml:"max_entries"`
+	Dir        string        `yaml:"dir"`
+}
+
+func (c *Config) applyCacheDefaults() {
+	if c.Cache == nil {
+		return
+	}
+	if c.Cache.TTL == 0 {
+		c.Cache.TTL = defaultCacheTTL
+	}
+	if c.Cache.MaxEntries == 0 {
+		c.Cache.MaxEntries = defaultCacheMaxEntries
+	}
+}
+
+func validateCache(c *Cache) error {
+	if c == nil {
+		return nil
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("cache.ttl must not be negative")
+	}
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("cache.max_entries must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitWindow           = time.Minute
+	defaultCircuitMinRequests      = 10
+	defaultCircuitCooldown         = 30 * time.Second
+)
+
+type CircuitBreaker struct {
+	FailureThreshold   int           `yaml:"failure_threshold"`
+	ErrorRateThreshold float64       `yaml:"error_rate_threshold"`
+	Window             time.Duration `yaml:"window"`
+	MinRequests        int           `yaml:"min_requests"`
+	Cooldown           time.Duration `yaml:"cooldown"`
+}
+
+func (c *Config) applyCircuitBreakerDefaults() {
+	if c.CircuitBreaker == nil {
+		return
+	}
+	cb := c.CircuitBreaker
+	if cb.FailureThreshold == 0 {
+		cb.FailureThreshold = defaultCircuitFailureThreshold
+	}
+	if cb.Window == 0 {
+		cb.Window = defaultCircuitWindow
+	}
+	if cb.MinRequests == 0 {
+		cb.MinRequests = defaultCircuitMinRequests
+	}
+	if cb.Cooldown == 0 {
+		cb.Cooldown = defaultCircuitCooldown
+	}
+}
+
+func validateCircuitBreaker(cb *CircuitBreaker) error {
+	if cb == nil {
+		return nil
+	}
+	if cb.FailureThreshold < 0 {
+		return fmt.Errorf("circuit_breaker.failure_threshold must not be negative")
+	}
+	if cb.ErrorRateThreshold < 0 || cb.ErrorRateThreshold > 1 {
+		return fmt.Errorf("circuit_breaker.error_rate_threshold must be between 0 and 1")
+	}
+	if cb.Window < 0 || cb.Cooldown < 0 {
+		return fmt.Errorf("circuit_breaker durations must not be negative")
+	}
+	if cb.MinRequests < 0 {
+		return fmt.Errorf("circuit_breaker.min_requests must not be negative")
+	}
+	return nil
+}
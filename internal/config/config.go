@@ -15,17 +15,43 @@ const (
 
 	AuthTypeXAPIKey = "x-api-key"
 	AuthTypeBearer  = "bearer"
+	AuthTypeQuery   = "query"
+	AuthTypeSigV4   = "aws_sigv4"
+	AuthTypeOAuth   = "google_oauth"
+
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+	ProviderGemini    = "gemini"
+	ProviderBedrock   = "bedrock"
+	ProviderVertex    = "vertex"
 )
 
 type Config struct {
-	Listen    string       `yaml:"listen"`
-	ModelList []ModelRoute `yaml:"model_list"`
-	index     map[string]int
+	Listen         Listeners             `yaml:"listen"`
+	ModelList      []ModelRoute          `yaml:"model_list"`
+	Retry          *RetryPolicy          `yaml:"retry"`
+	CircuitBreaker *CircuitBreaker       `yaml:"circuit_breaker"`
+	Keys           []VirtualKey          `yaml:"keys"`
+	Pricing        map[string]ModelPrice `yaml:"pricing"`
+	Spend          *SpendTracking        `yaml:"spend"`
+	Tracing        *Tracing              `yaml:"tracing"`
+	Audit          *Audit                `yaml:"audit"`
+	Cache          *Cache                `yaml:"cache"`
+	Streaming      *Streaming            `yaml:"streaming"`
+	Transport      *Transport            `yaml:"transport"`
+	Shutdown       *Shutdown             `yaml:"shutdown"`
+	Admin          *Admin                `yaml:"admin"`
+	index          map[string]int
+	keyIndex       map[string]int
 }
 
 type ModelRoute struct {
-	ModelName string         `yaml:"model_name"`
-	Params    UpstreamParams `yaml:"params"`
+	ModelName   string           `yaml:"model_name"`
+	Params      UpstreamParams   `yaml:"params"`
+	Deployments []UpstreamParams `yaml:"deployments"`
+	Fallbacks   []string         `yaml:"fallbacks"`
+	Retry       *RetryPolicy     `yaml:"retry"`
+	Transport   *Transport       `yaml:"transport"`
 }
 
 type UpstreamParams struct {
@@ -33,6 +59,35 @@ type UpstreamParams struct {
 	APIBase  string `yaml:"api_base"`
 	APIKey   string `yaml:"api_key"`
 	AuthType string `yaml:"auth_type"`
+	Provider string `yaml:"provider"`
+	Weight   int    `yaml:"weight"`
+
+	RateLimit         *RateLimit `yaml:"rate_limit"`
+	ForceNonStreaming bool       `yaml:"force_non_streaming"`
+	ForceStreaming    bool       `yaml:"force_streaming"`
+
+	AWSRegion          string `yaml:"aws_region"`
+	AWSAccessKeyID     string `yaml:"aws_access_key_id"`
+	AWSSecretAccessKey string `yaml:"aws_secret_access_key"`
+	AWSSessionToken    string `yaml:"aws_session_token"`
+
+	VertexProject   string `yaml:"vertex_project"`
+	VertexRegion    string `yaml:"vertex_region"`
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+func (r ModelRoute) Upstreams() []UpstreamParams {
+	if len(r.Deployments) > 0 {
+		return r.Deployments
+	}
+	return []UpstreamParams{r.Params}
+}
+
+func (p UpstreamParams) EffectiveWeight() int {
+	if p.Weight <= 0 {
+		return 1
+	}
+	return p.Weight
 }
 
 func Load(path string) (*Config, error) {
@@ -55,21 +110,94 @@ func Load(path string) (*Config, error) {
 }
 
 func (c *Config) applyDefaults() {
-	if strings.TrimSpace(c.Listen) == "" {
-		c.Listen = defaultListen
+	if len(c.Listen) == 0 {
+		c.Listen = Listeners{{Address: defaultListen}}
 	}
 
+	c.applyCircuitBreakerDefaults()
+	c.applyTracingDefaults()
+	c.applyAuditDefaults()
+	c.applyCacheDefaults()
+
 	for i := range c.ModelList {
-		if strings.TrimSpace(c.ModelList[i].Params.AuthType) == "" {
-			c.ModelList[i].Params.AuthType = AuthTypeXAPIKey
+		route := &c.ModelList[i]
+		applyUpstreamDefaults(&route.Params)
+		for j := range route.Deployments {
+			applyUpstreamDefaults(&route.Deployments[j])
 		}
 	}
 }
 
+func applyUpstreamDefaults(p *UpstreamParams) {
+	if strings.TrimSpace(p.Provider) == "" {
+		p.Provider = ProviderAnthropic
+	}
+	if strings.TrimSpace(p.AuthType) == "" {
+		switch strings.ToLower(strings.TrimSpace(p.Provider)) {
+		case ProviderOpenAI:
+			p.AuthType = AuthTypeBearer
+		case ProviderBedrock:
+			p.AuthType = AuthTypeSigV4
+		case ProviderVertex:
+			p.AuthType = AuthTypeOAuth
+		default:
+			p.AuthType = AuthTypeXAPIKey
+		}
+	}
+	if p.Weight == 0 {
+		p.Weight = 1
+	}
+	if strings.TrimSpace(p.APIBase) == "" && strings.EqualFold(strings.TrimSpace(p.Provider), ProviderBedrock) && strings.TrimSpace(p.AWSRegion) != "" {
+		p.APIBase = "https://bedrock-runtime." + strings.TrimSpace(p.AWSRegion) + ".amazonaws.com"
+	}
+	if strings.TrimSpace(p.APIBase) == "" && strings.EqualFold(strings.TrimSpace(p.Provider), ProviderVertex) &&
+		strings.TrimSpace(p.VertexProject) != "" && strings.TrimSpace(p.VertexRegion) != "" {
+		p.APIBase = vertexAPIBase(strings.TrimSpace(p.VertexProject), strings.TrimSpace(p.VertexRegion))
+	}
+}
+
+func vertexAPIBase(project, region string) string {
+	host := region + "-aiplatform.googleapis.com"
+	if region == "global" {
+		host = "aiplatform.googleapis.com"
+	}
+	return "https://" + host + "/v1/projects/" + project + "/locations/" + region
+}
+
 func (c *Config) Validate() error {
 	if len(c.ModelList) == 0 {
 		return fmt.Errorf("model_list is required")
 	}
+	if err := validateListeners(c.Listen); err != nil {
+		return err
+	}
+	if err := validateRetryPolicy(c.Retry, "retry"); err != nil {
+		return err
+	}
+	if err := validateCircuitBreaker(c.CircuitBreaker); err != nil {
+		return err
+	}
+	if err := validatePricing(c.Pricing); err != nil {
+		return err
+	}
+	if err := validateTracing(c.Tracing); err != nil {
+		return err
+	}
+	if err := validateAudit(c.Audit); err != nil {
+		return err
+	}
+	if err := validateCache(c.Cache); err != nil {
+		return err
+	}
+	if err := validateStreaming(c.Streaming); err != nil {
+		return err
+	}
+	if err := validateTransport(c.Transport, "transport"); err != nil {
+		return err
+	}
+	if err := validateShutdown(c.Shutdown); err != nil {
+		return err
+	}
 
 	index := make(map[string]int, len(c.ModelList))
 	for i, route := range c.ModelList {
@@ -81,36 +209,137 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("duplicate model_name: %s", modelName)
 		}
 
-		if strings.TrimSpace(route.Params.Model) == "" {
-			return fmt.Errorf("model_list[%d].params.model is required", i)
+		if len(route.Deployments) == 0 {
+			if err := validateUpstream(&c.ModelList[i].Params, fmt.Sprintf("model_list[%d].params", i)); err != nil {
+				return err
+			}
+		} else {
+			if strings.TrimSpace(route.Params.Model) != "" || strings.TrimSpace(route.Params.APIBase) != "" {
+				return fmt.Errorf("model_list[%d] must set either params or deployments, not both", i)
+			}
+			for j := range route.Deployments {
+				if err := validateUpstream(&c.ModelList[i].Deployments[j], fmt.Sprintf("model_list[%d].deployments[%d]", i, j)); err != nil {
+					return err
+				}
+			}
 		}
-		if strings.TrimSpace(route.Params.APIBase) == "" {
-			return fmt.Errorf("model_list[%d].params.api_base is required", i)
+
+		if err := validateRetryPolicy(route.Retry, fmt.Sprintf("model_list[%d].retry", i)); err != nil {
+			return err
 		}
-		u, err := url.Parse(route.Params.APIBase)
-		if err != nil || u.Scheme == "" || u.Host == "" {
-			return fmt.Errorf("model_list[%d].params.api_base is invalid: %s", i, route.Params.APIBase)
+		if err := validateTransport(route.Transport, fmt.Sprintf("model_list[%d].transport", i)); err != nil {
+			return err
 		}
-		if u.Scheme != "http" && u.Scheme != "https" {
-			return fmt.Errorf("model_list[%d].params.api_base must use http/https", i)
+
+		c.ModelList[i].ModelName = modelName
+		index[modelName] = i
+	}
+
+	if err := validateDeploymentRateLimits(c.ModelList); err != nil {
+		return err
+	}
+
+	for i, route := range c.ModelList {
+		for j, fallback := range route.Fallbacks {
+			fallback = strings.TrimSpace(fallback)
+			if fallback == route.ModelName {
+				return fmt.Errorf("model_list[%d].fallbacks[%d] must not reference its own model_name", i, j)
+			}
+			if _, exists := index[fallback]; !exists {
+				return fmt.Errorf("model_list[%d].fallbacks[%d] references unknown model_name: %s", i, j, fallback)
+			}
+			c.ModelList[i].Fallbacks[j] = fallback
 		}
-		if strings.TrimSpace(route.Params.APIKey) == "" {
-			return fmt.Errorf("model_list[%d].params.api_key is required", i)
+	}
+	if err := c.validateKeys(index); err != nil {
+		return err
+	}
+	if err := c.validateAdmin(); err != nil {
+		return err
+	}
+	if err := c.validateBudgetPricing(); err != nil {
+		return err
+	}
+
+	c.index = index
+	return nil
+}
+
+func validateUpstream(p *UpstreamParams, field string) error {
+	if strings.TrimSpace(p.Model) == "" {
+		return fmt.Errorf("%s.model is required", field)
+	}
+	if strings.TrimSpace(p.APIBase) == "" {
+		if strings.EqualFold(strings.TrimSpace(p.Provider), ProviderVertex) {
+			return fmt.Errorf("%s.api_base or vertex_project and vertex_region are required", field)
 		}
+		return fmt.Errorf("%s.api_base is required", field)
+	}
+	u, err := url.Parse(p.APIBase)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s.api_base is invalid: %s", field, p.APIBase)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s.api_base must use http/https", field)
+	}
+	if p.Weight < 0 {
+		return fmt.Errorf("%s.weight must not be negative", field)
+	}
+	if err := validateRateLimit(p.RateLimit, field+".rate_limit"); err != nil {
+		return err
+	}
+	if p.ForceStreaming && p.ForceNonStreaming {
+		return fmt.Errorf("%s must not set both force_streaming and force_non_streaming", field)
+	}
 
-		authType := strings.ToLower(strings.TrimSpace(route.Params.AuthType))
-		switch authType {
-		case AuthTypeXAPIKey, AuthTypeBearer:
-		default:
-			return fmt.Errorf("model_list[%d].params.auth_type must be x-api-key or bearer", i)
+	provider := strings.ToLower(strings.TrimSpace(p.Provider))
+	switch provider {
+	case "":
+		provider = ProviderAnthropic
+	case ProviderAnthropic, ProviderOpenAI, ProviderGemini, ProviderBedrock, ProviderVertex:
+	default:
+		return fmt.Errorf("%s.provider must be anthropic, openai, gemini, bedrock or vertex", field)
+	}
+
+	authType := strings.ToLower(strings.TrimSpace(p.AuthType))
+	switch authType {
+	case AuthTypeXAPIKey, AuthTypeBearer:
+	case AuthTypeQuery:
+		if provider != ProviderGemini {
+			return fmt.Errorf("%s.auth_type query is only supported for provider gemini", field)
+		}
+	case AuthTypeSigV4:
+		if provider != ProviderBedrock {
+			return fmt.Errorf("%s.auth_type aws_sigv4 is only supported for provider bedrock", field)
+		}
+	case AuthTypeOAuth:
+		if provider != ProviderVertex {
+			return fmt.Errorf("%s.auth_type google_oauth is only supported for provider vertex", field)
 		}
+	default:
+		return fmt.Errorf("%s.auth_type must be x-api-key, bearer, query, aws_sigv4 or google_oauth", field)
+	}
 
-		c.ModelList[i].ModelName = modelName
-		c.ModelList[i].Params.AuthType = authType
-		index[modelName] = i
+	switch authType {
+	case AuthTypeSigV4:
+		if strings.TrimSpace(p.AWSRegion) == "" {
+			return fmt.Errorf("%s.aws_region is required", field)
+		}
+		if strings.TrimSpace(p.AWSAccessKeyID) == "" || strings.TrimSpace(p.AWSSecretAccessKey) == "" {
+			return fmt.Errorf("%s.aws_access_key_id and aws_secret_access_key are required", field)
+		}
+	case AuthTypeOAuth:
+		if strings.TrimSpace(p.CredentialsFile) == "" {
+			return fmt.Errorf("%s.credentials_file is required", field)
+		}
+	default:
+		if strings.TrimSpace(p.APIKey) == "" {
+			return fmt.Errorf("%s.api_key is required", field)
+		}
 	}
 
-	c.index = index
+	p.AuthType = authType
+	p.Provider = provider
 	return nil
 }
 
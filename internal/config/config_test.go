@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"anthropic-gateway/internal/config"
 )
@@ -25,8 +26,8 @@ model_list:
 		t.Fatalf("load config: %v", err)
 	}
 
-	if got, want := cfg.Listen, ":4000"; got != want {
-		t.Fatalf("listen = %q, want %q", got, want)
+	if len(cfg.Listen) != 1 || cfg.Listen[0].Address != ":4000" {
+		t.Fatalf("listen = %+v, want :4000", cfg.Listen)
 	}
 	if got, want := cfg.ModelList[0].Params.AuthType, config.AuthTypeXAPIKey; got != want {
 		t.Fatalf("auth_type = %q, want %q", got, want)
@@ -57,6 +58,659 @@ model_list:
 	}
 }
 
+func TestLoadDeploymentsWithWeights(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    deployments:
+      - model: glm-4.7
+        api_base: https://a.example.com
+        api_key: a
+        weight: 3
+      - model: glm-4.7
+        api_base: https://b.example.com
+        api_key: b
+        auth_type: Bearer
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	route, ok := cfg.RouteByModel("sonnet")
+	if !ok {
+		t.Fatalf("route sonnet not found")
+	}
+	upstreams := route.Upstreams()
+	if len(upstreams) != 2 {
+		t.Fatalf("upstreams = %d, want 2", len(upstreams))
+	}
+	if got := upstreams[0].Weight; got != 3 {
+		t.Fatalf("weight = %d, want 3", got)
+	}
+	if got := upstreams[1].Weight; got != 1 {
+		t.Fatalf("default weight = %d, want 1", got)
+	}
+	if got := upstreams[1].AuthType; got != config.AuthTypeBearer {
+		t.Fatalf("auth_type = %q, want %q", got, config.AuthTypeBearer)
+	}
+}
+
+func TestLoadFailsOnParamsAndDeployments(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+    deployments:
+      - model: glm-4.7
+        api_base: https://b.example.com
+        api_key: b
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "either params or deployments") {
+		t.Fatalf("expected params/deployments conflict error, got %v", err)
+	}
+}
+
+func TestLoadFailsOnNegativeWeight(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    deployments:
+      - model: glm-4.7
+        api_base: https://api.example.com
+        api_key: a
+        weight: -1
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "deployments[0].weight") {
+		t.Fatalf("expected weight error, got %v", err)
+	}
+}
+
+func TestLoadFailsOnUnknownFallback(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+    fallbacks: [haiku]
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "unknown model_name: haiku") {
+		t.Fatalf("expected unknown fallback error, got %v", err)
+	}
+}
+
+func TestRetryPolicyRouteOverridesGlobal(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+retry:
+  max_attempts: 3
+  base_backoff: 200ms
+  max_backoff: 5s
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+    retry:
+      max_attempts: 5
+      retry_on_status: [529]
+      retry_on_errors: [Timeout]
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	route, _ := cfg.RouteByModel("sonnet")
+	policy := cfg.RetryPolicyFor(route)
+	if policy.MaxAttempts != 5 {
+		t.Fatalf("max_attempts = %d, want 5", policy.MaxAttempts)
+	}
+	if policy.BaseBackoff != 200*time.Millisecond || policy.MaxBackoff != 5*time.Second {
+		t.Fatalf("backoff = %v/%v", policy.BaseBackoff, policy.MaxBackoff)
+	}
+	if policy.RetriesStatus(500) || !policy.RetriesStatus(529) {
+		t.Fatalf("retry_on_status override not applied")
+	}
+	if policy.RetriesError(config.RetryOnConnect) || !policy.RetriesError(config.RetryOnTimeout) {
+		t.Fatalf("retry_on_errors override not applied")
+	}
+}
+
+func TestLoadFailsOnInvalidRetryErrorClass(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+retry:
+  retry_on_errors: [dns]
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "retry.retry_on_errors[0]") {
+		t.Fatalf("expected retry_on_errors error, got %v", err)
+	}
+}
+
+func TestLoadOpenAIProviderDefaultsToBearer(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: local
+    params:
+      model: qwen3
+      api_base: http://localhost:8000
+      api_key: none
+      provider: OpenAI
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	params := cfg.ModelList[0].Params
+	if params.Provider != config.ProviderOpenAI || params.AuthType != config.AuthTypeBearer {
+		t.Fatalf("provider/auth_type = %q/%q", params.Provider, params.AuthType)
+	}
+}
+
+func TestLoadGeminiProviderDefaultsToQueryKey(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: gemini
+    params:
+      model: gemini-2.5-pro
+      api_base: https://generativelanguage.googleapis.com
+      api_key: g
+      provider: gemini
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	params := cfg.ModelList[0].Params
+	if params.Provider != config.ProviderGemini || params.AuthType != config.AuthTypeXAPIKey {
+		t.Fatalf("provider/auth_type = %q/%q", params.Provider, params.AuthType)
+	}
+}
+
+func TestLoadFailsOnQueryAuthForAnthropic(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+      auth_type: query
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "only supported for provider gemini") {
+		t.Fatalf("expected query auth_type error, got %v", err)
+	}
+}
+
+func TestLoadBedrockProviderDefaults(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: anthropic.claude-sonnet-4-20250514-v1:0
+      provider: bedrock
+      aws_region: us-west-2
+      aws_access_key_id: AKID
+      aws_secret_access_key: secret
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	params := cfg.ModelList[0].Params
+	if params.AuthType != config.AuthTypeSigV4 || params.APIBase != "https://bedrock-runtime.us-west-2.amazonaws.com" {
+		t.Fatalf("auth_type/api_base = %q/%q", params.AuthType, params.APIBase)
+	}
+}
+
+func TestLoadFailsOnSigV4WithoutCredentials(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: anthropic.claude-sonnet-4-20250514-v1:0
+      provider: bedrock
+      aws_region: us-west-2
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "aws_access_key_id") {
+		t.Fatalf("expected aws credentials error, got %v", err)
+	}
+}
+
+func TestLoadVertexProviderDefaults(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: claude-sonnet-4@20250514
+      provider: vertex
+      vertex_project: my-project
+      vertex_region: us-east5
+      credentials_file: /etc/gateway/sa.json
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	params := cfg.ModelList[0].Params
+	if params.AuthType != config.AuthTypeOAuth {
+		t.Fatalf("auth_type = %q", params.AuthType)
+	}
+	if params.APIBase != "https://us-east5-aiplatform.googleapis.com/v1/projects/my-project/locations/us-east5" {
+		t.Fatalf("api_base = %q", params.APIBase)
+	}
+}
+
+func TestLoadFailsOnVertexWithoutCredentialsFile(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: claude-sonnet-4@20250514
+      provider: vertex
+      vertex_project: my-project
+      vertex_region: us-east5
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "credentials_file is required") {
+		t.Fatalf("expected credentials_file error, got %v", err)
+	}
+}
+
+func TestLoadVirtualKeys(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+keys:
+  - name: alice
+    key: sk-alice
+    models: [sonnet]
+  - name: bob
+    key: sk-bob
+    enabled: false
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	alice, ok := cfg.LookupKey("sk-alice")
+	if !ok || !alice.IsEnabled() || !alice.AllowsModel("sonnet") || alice.AllowsModel("opus") {
+		t.Fatalf("alice = %+v", alice)
+	}
+	bob, ok := cfg.LookupKey("sk-bob")
+	if !ok || bob.IsEnabled() || !bob.AllowsModel("sonnet") {
+		t.Fatalf("bob = %+v", bob)
+	}
+}
+
+func TestLoadFailsOnKeyWithUnknownModel(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+keys:
+  - name: alice
+    key: sk-alice
+    models: [opus]
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "keys[0].models[0] references unknown model_name") {
+		t.Fatalf("expected unknown model error, got %v", err)
+	}
+}
+
+func TestLoadFailsOnNegativeRateLimit(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+      rate_limit:
+        requests_per_minute: -1
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "model_list[0].params.rate_limit limits must not be negative") {
+		t.Fatalf("expected rate_limit error, got %v", err)
+	}
+}
+
+func TestLoadParsesPricingAndBudgets(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+pricing:
+  glm-4.7:
+    input: 3
+    output: 15
+    cache_read: 0.3
+spend:
+  file: /tmp/spend.json
+keys:
+  - name: alice
+    key: sk-alice
+    budget:
+      daily: 10
+      monthly: 200
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	price, ok := cfg.PriceFor("glm-4.7")
+	if !ok || price.Input != 3 || price.Output != 15 || price.CacheRead != 0.3 {
+		t.Fatalf("unexpected price: %+v %v", price, ok)
+	}
+	if cfg.Spend == nil || cfg.Spend.File != "/tmp/spend.json" {
+		t.Fatalf("unexpected spend: %+v", cfg.Spend)
+	}
+	key, ok := cfg.LookupKey("sk-alice")
+	if !ok || key.Budget == nil || key.Budget.Daily != 10 || key.Budget.Monthly != 200 {
+		t.Fatalf("unexpected key budget: %+v", key)
+	}
+}
+
+func TestLoadFailsOnNegativeBudget(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+keys:
+  - name: alice
+    key: sk-alice
+    budget:
+      daily: -1
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "keys[0].budget must not be negative") {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+}
+
+func TestLoadFailsOnConflictingStreamingOverrides(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+      force_streaming: true
+      force_non_streaming: true
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "must not set both force_streaming and force_non_streaming") {
+		t.Fatalf("expected streaming override error, got %v", err)
+	}
+}
+
+func TestLoadParsesStreaming(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+streaming:
+  ping_interval: 15s
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	policy := cfg.StreamingPolicy()
+	if policy.IdleTimeout != 5*time.Minute || policy.PingInterval != 15*time.Second {
+		t.Fatalf("streaming policy = %+v", policy)
+	}
+	if got := (&config.Config{}).StreamingPolicy(); got.IdleTimeout != 5*time.Minute || got.PingInterval != 0 {
+		t.Fatalf("default streaming policy = %+v", got)
+	}
+}
+
+func TestLoadMergesRouteTransportOverGlobal(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+transport:
+  connect_timeout: 5s
+  request_timeout: 10m
+  max_idle_conns_per_host: 50
+model_list:
+  - model_name: sonnet
+    transport:
+      request_timeout: 30s
+      max_conns_per_host: 20
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	route, _ := cfg.RouteByModel("sonnet")
+	got := cfg.TransportFor(route)
+	want := config.Transport{
+		ConnectTimeout:      5 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		RequestTimeout:      30 * time.Second,
+		MaxIdleConnsPerHost: 50,
+		MaxConnsPerHost:     20,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if got != want {
+		t.Fatalf("transport = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadFailsOnInvalidTransport(t *testing.T) {
+	for _, tc := range []struct {
+		transport string
+		want      string
+	}{
+		{"proxy: ftp://proxy.internal:21", "model_list[0].transport.proxy must use http, https, socks5 or socks5h"},
+		{"cert_file: /etc/gateway/client.crt", "model_list[0].transport.cert_file and key_file must be set together"},
+	} {
+		cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    transport:
+      `+tc.transport+`
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+		_, err := config.Load(cfgPath)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected %q, got %v", tc.want, err)
+		}
+	}
+}
+
+func TestLoadParsesListeners(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+listen:
+  - ":4000"
+  - address: ":8443"
+    cert_file: /etc/gateway/tls.crt
+    key_file: /etc/gateway/tls.key
+  - address: unix:///run/gateway.sock
+    socket_mode: "0660"
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(cfg.Listen) != 3 {
+		t.Fatalf("listen = %+v", cfg.Listen)
+	}
+	if network, addr := cfg.Listen[0].Network(); network != "tcp" || addr != ":4000" || cfg.Listen[0].TLS() {
+		t.Fatalf("listen[0] = %s %s", network, addr)
+	}
+	if !cfg.Listen[1].TLS() || cfg.Listen[1].KeyFile != "/etc/gateway/tls.key" {
+		t.Fatalf("listen[1] = %+v", cfg.Listen[1])
+	}
+	if network, addr := cfg.Listen[2].Network(); network != "unix" || addr != "/run/gateway.sock" || cfg.Listen[2].FileMode() != 0o660 {
+		t.Fatalf("listen[2] = %s %s %o", network, addr, cfg.Listen[2].FileMode())
+	}
+}
+
+func TestLoadFailsOnSocketModeForTCPListener(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+listen:
+  - address: ":4000"
+    socket_mode: "0600"
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "listen[0].socket_mode is only supported for unix:// addresses") {
+		t.Fatalf("expected socket_mode error, got %v", err)
+	}
+}
+
+func TestLoadParsesShutdown(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+shutdown:
+  drain_timeout: 2m
+  grace_timeout: 15s
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if got := cfg.ShutdownPolicy().DrainTimeout; got != 2*time.Minute {
+		t.Fatalf("drain_timeout = %s", got)
+	}
+	if got := cfg.ShutdownPolicy().GraceTimeout; got != 15*time.Second {
+		t.Fatalf("grace_timeout = %s", got)
+	}
+	defaults := (&config.Config{}).ShutdownPolicy()
+	if defaults.DrainTimeout != 30*time.Second || defaults.GraceTimeout != 5*time.Second {
+		t.Fatalf("default shutdown policy = %+v", defaults)
+	}
+}
+
+func TestLoadParsesTracing(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+tracing:
+  endpoint: http://localhost:4318/
+  headers:
+    authorization: Bearer token
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.Tracing.ServiceName != "anthropic-gateway" {
+		t.Fatalf("service_name = %q", cfg.Tracing.ServiceName)
+	}
+	if got := cfg.Tracing.TracesURL(); got != "http://localhost:4318/v1/traces" {
+		t.Fatalf("traces URL = %q", got)
+	}
+	if cfg.Tracing.Headers["authorization"] != "Bearer token" {
+		t.Fatalf("headers = %v", cfg.Tracing.Headers)
+	}
+}
+
+func TestLoadFailsOnInvalidTracingEndpoint(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+tracing:
+  endpoint: localhost:4318
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "tracing.endpoint must be an http/https URL") {
+		t.Fatalf("expected tracing endpoint error, got %v", err)
+	}
+}
+
 func TestLoadFailsOnInvalidAPIBase(t *testing.T) {
 	cfgPath := writeTempConfig(t, `
 model_list:
@@ -106,6 +760,122 @@ model_list:
 	}
 }
 
+func TestLoadFailsOnUnpricedModelWithBudget(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+pricing:
+  glm-4.7:
+    input: 3
+    output: 15
+keys:
+  - name: alice
+    key: sk-alice
+    budget:
+      daily: 10
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+  - model_name: haiku
+    params:
+      model: glm-4.5-air
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "model_list[1] model glm-4.5-air has no pricing entry but keys[0] has a budget") {
+		t.Fatalf("expected unpriced model error, got %v", err)
+	}
+}
+
+func TestLoadFailsOnAdminKeyMatchingVirtualKey(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+admin:
+  key: sk-alice
+keys:
+  - name: alice
+    key: sk-alice
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "admin.key must not match a virtual key") {
+		t.Fatalf("expected admin key error, got %v", err)
+	}
+}
+
+func TestLoadHonoursZeroRetryOverrides(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+retry:
+  max_attempts: 3
+  base_backoff: 200ms
+  jitter: 0.5
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+    retry:
+      base_backoff: 0s
+      jitter: 0
+  - model_name: haiku
+    params:
+      model: glm-4.5
+      api_base: https://api.example.com
+      api_key: a
+    retry:
+      max_attempts: 2
+`)
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	route, _ := cfg.RouteByModel("sonnet")
+	policy := cfg.RetryPolicyFor(route)
+	if policy.MaxAttempts != 3 || policy.BaseBackoff != 0 || policy.Jitter != 0 {
+		t.Fatalf("policy = %+v, want zeroed backoff and jitter", policy)
+	}
+	route, _ = cfg.RouteByModel("haiku")
+	policy = cfg.RetryPolicyFor(route)
+	if policy.MaxAttempts != 2 || policy.BaseBackoff != 200*time.Millisecond || policy.Jitter != 0.5 {
+		t.Fatalf("policy = %+v, want global backoff and jitter kept", policy)
+	}
+}
+
+func TestLoadFailsOnConflictingDeploymentRateLimits(t *testing.T) {
+	cfgPath := writeTempConfig(t, `
+model_list:
+  - model_name: sonnet
+    params:
+      model: glm-4.7
+      api_base: https://api.example.com
+      api_key: a
+      rate_limit:
+        requests_per_minute: 60
+  - model_name: sonnet-batch
+    deployments:
+      - model: glm-4.7
+        api_base: https://api.example.com
+        api_key: a
+        rate_limit:
+          requests_per_minute: 10
+`)
+
+	_, err := config.Load(cfgPath)
+	if err == nil || !strings.Contains(err.Error(), "model_list[1] sets a different rate_limit for deployment glm-4.7") {
+		t.Fatalf("expected conflicting rate_limit error, got %v", err)
+	}
+}
+
 func writeTempConfig(t *testing.T, content string) string {
 	t.Helper()
 	dir := t.TempDir()
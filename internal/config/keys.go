@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+type VirtualKey struct {
+	Name      string     `yaml:"name"`
+	Key       string     `yaml:"key"`
+	Models    []string   `yaml:"models"`
+	Enabled   *bool      `yaml:"enabled"`
+	RateLimit *RateLimit `yaml:"rate_limit"`
+	Budget    *Budget    `yaml:"budget"`
+}
+
+func (k VirtualKey) IsEnabled() bool {
+	return k.Enabled == nil || *k.Enabled
+}
+
+func (k VirtualKey) AllowsModel(modelName string) bool {
+	if len(k.Models) == 0 {
+		return true
+	}
+	for _, allowed := range k.Models {
+		if allowed == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) KeysEnabled() bool {
+	return len(c.Keys) > 0
+}
+
+func (c *Config) LookupKey(key string) (VirtualKey, bool) {
+	i, ok := c.keyIndex[key]
+	if !ok {
+		return VirtualKey{}, false
+	}
+	return c.Keys[i], true
+}
+
+func (c *Config) validateKeys(models map[string]int) error {
+	names := make(map[string]bool, len(c.Keys))
+	keyIndex := make(map[string]int, len(c.Keys))
+	for i := range c.Keys {
+		k := &c.Keys[i]
+		k.Name = strings.TrimSpace(k.Name)
+		k.Key = strings.TrimSpace(k.Key)
+		if k.Name == "" {
+			return fmt.Errorf("keys[%d].name is required", i)
+		}
+		if names[k.Name] {
+			return fmt.Errorf("duplicate key name: %s", k.Name)
+		}
+		if k.Key == "" {
+			return fmt.Errorf("keys[%d].key is required", i)
+		}
+		if _, exists := keyIndex[k.Key]; exists {
+			return fmt.Errorf("keys[%d].key duplicates another key", i)
+		}
+		if err := validateRateLimit(k.RateLimit, fmt.Sprintf("keys[%d].rate_limit", i)); err != nil {
+			return err
+		}
+		if err := validateBudget(k.Budget, fmt.Sprintf("keys[%d].budget", i)); err != nil {
+			return err
+		}
+		for j, model := range k.Models {
+			model = strings.TrimSpace(model)
+			if _, exists := models[model]; !exists {
+				return fmt.Errorf("keys[%d].models[%d] references unknown model_name: %s", i, j, model)
+			}
+			k.Models[j] = model
+		}
+		names[k.Name] = true
+		keyIndex[k.Key] = i
+	}
+	c.keyIndex = keyIndex
+	return nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	unixScheme        = "unix://"
+	defaultSocketMode = 0o600
+)
+
+type Listener struct {
+	Address    string `yaml:"address"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	SocketMode string `yaml:"socket_mode"`
+}
+
+type Listeners []Listener
+
+func (l *Listener) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		l.Address = node.Value
+		return nil
+	}
+	type plain Listener
+	return node.Decode((*plain)(l))
+}
+
+func (l *Listeners) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = Listeners{{Address: node.Value}}
+		return nil
+	}
+	var listeners []Listener
+	if err := node.Decode(&listeners); err != nil {
+		return err
+	}
+	*l = listeners
+	return nil
+}
+
+func (l Listeners) Addresses() []string {
+	addrs := make([]string, len(l))
+	for i, listener := range l {
+		addrs[i] = listener.Address
+	}
+	return addrs
+}
+
+func (l Listener) Network() (string, string) {
+	if path, ok := strings.CutPrefix(l.Address, unixScheme); ok {
+		return "unix", path
+	}
+	return "tcp", l.Address
+}
+
+func (l Listener) TLS() bool {
+	return l.CertFile != ""
+}
+
+func (l Listener) FileMode() os.FileMode {
+	mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+	if l.SocketMode == "" || err != nil {
+		return defaultSocketMode
+	}
+	return os.FileMode(mode)
+}
+
+func validateListeners(listeners Listeners) error {
+	for i, l := range listeners {
+		field := fmt.Sprintf("listen[%d]", i)
+		network, addr := l.Network()
+		if strings.TrimSpace(addr) == "" {
+			return fmt.Errorf("%s.address is required", field)
+		}
+		if (l.CertFile == "") != (l.KeyFile == "") {
+			return fmt.Errorf("%s.cert_file and key_file must be set together", field)
+		}
+		if l.SocketMode != "" {
+			if network != "unix" {
+				return fmt.Errorf("%s.socket_mode is only supported for unix:// addresses", field)
+			}
+			if mode, err := strconv.ParseUint(l.SocketMode, 8, 32); err != nil || mode > 0o777 {
+				return fmt.Errorf("%s.socket_mode must be an octal file mode such as 0600", field)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import "fmt"
+
+type RateLimit struct {
+	RequestsPerMinute     int `yaml:"requests_per_minute"`
+	InputTokensPerMinute  int `yaml:"input_tokens_per_minute"`
+	OutputTokensPerMinute int `yaml:"output_tokens_per_minute"`
+}
+
+func validateRateLimit(rl *RateLimit, field string) error {
+	if rl == nil {
+		return nil
+	}
+	if rl.RequestsPerMinute < 0 || rl.InputTokensPerMinute < 0 || rl.OutputTokensPerMinute < 0 {
+		return fmt.Errorf("%s limits must not be negative", field)
+	}
+	return nil
+}
+
+func validateDeploymentRateLimits(routes []ModelRoute) error {
+	seen := make(map[string]RateLimit)
+	for i, route := range routes {
+		for _, p := range route.Upstreams() {
+			if p.RateLimit == nil {
+				continue
+			}
+			key := p.APIBase + "|" + p.Model
+			if limit, ok := seen[key]; ok && limit != *p.RateLimit {
+				return fmt.Errorf("model_list[%d] sets a different rate_limit for deployment %s (%s) than an earlier route", i, p.Model, p.APIBase)
+			}
+			seen[key] = *p.RateLimit
+		}
+	}
+	return nil
+}
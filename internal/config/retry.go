@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RetryOnConnect = "connect"
+	RetryOnTimeout = "timeout"
+
+	defaultRetryMaxAttempts = 1
+	defaultRetryBaseBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff  = 10 * time.Second
+	defaultRetryJitter      = 0.2
+)
+
+type RetryPolicy struct {
+	MaxAttempts   int           `yaml:"max_attempts"`
+	BaseBackoff   time.Duration `yaml:"base_backoff"`
+	MaxBackoff    time.Duration `yaml:"max_backoff"`
+	Jitter        float64       `yaml:"jitter"`
+	RetryOnStatus []int         `yaml:"retry_on_status"`
+	RetryOnErrors []string      `yaml:"retry_on_errors"`
+
+	set map[string]bool
+}
+
+func (p *RetryPolicy) UnmarshalYAML(node *yaml.Node) error {
+	type plain RetryPolicy
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	p.set = make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		p.set[node.Content[i].Value] = true
+	}
+	return nil
+}
+
+func (p RetryPolicy) overrides(field string, value bool) bool {
+	return value || p.set[field]
+}
+
+func (c *Config) RetryPolicyFor(route ModelRoute) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts:   defaultRetryMaxAttempts,
+		BaseBackoff:   defaultRetryBaseBackoff,
+		MaxBackoff:    defaultRetryMaxBackoff,
+		Jitter:        defaultRetryJitter,
+		RetryOnErrors: []string{RetryOnConnect, RetryOnTimeout},
+	}
+	if c.Retry != nil {
+		policy = policy.merge(*c.Retry)
+	}
+	if route.Retry != nil {
+		policy = policy.merge(*route.Retry)
+	}
+	return policy
+}
+
+func (p RetryPolicy) merge(override RetryPolicy) RetryPolicy {
+	if override.MaxAttempts > 0 {
+		p.MaxAttempts = override.MaxAttempts
+	}
+	if override.overrides("base_backoff", override.BaseBackoff > 0) {
+		p.BaseBackoff = override.BaseBackoff
+	}
+	if override.overrides("max_backoff", override.MaxBackoff > 0) {
+		p.MaxBackoff = override.MaxBackoff
+	}
+	if override.overrides("jitter", override.Jitter > 0) {
+		p.Jitter = override.Jitter
+	}
+	if override.RetryOnStatus != nil {
+		p.RetryOnStatus = override.RetryOnStatus
+	}
+	if override.RetryOnErrors != nil {
+		p.RetryOnErrors = override.RetryOnErrors
+	}
+	return p
+}
+
+func (p RetryPolicy) RetriesStatus(statusCode int) bool {
+	if p.RetryOnStatus == nil {
+		return statusCode == 429 || (statusCode >= 500 && statusCode <= 529)
+	}
+	for _, code := range p.RetryOnStatus {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (p RetryPolicy) RetriesError(class string) bool {
+	for _, c := range p.RetryOnErrors {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRetryPolicy(p *RetryPolicy, field string) error {
+	if p == nil {
+		return nil
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("%s.max_attempts must not be negative", field)
+	}
+	if p.BaseBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("%s backoff must not be negative", field)
+	}
+	if p.BaseBackoff > 0 && p.MaxBackoff > 0 && p.BaseBackoff > p.MaxBackoff {
+		return fmt.Errorf("%s.base_backoff must not exceed max_backoff", field)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("%s.jitter must be between 0 and 1", field)
+	}
+	for i, code := range p.RetryOnStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("%s.retry_on_status[%d] is not an HTTP status: %d", field, i, code)
+		}
+	}
+	for i, class := range p.RetryOnErrors {
+		class = strings.ToLower(strings.TrimSpace(class))
+		switch class {
+		case RetryOnConnect, RetryOnTimeout:
+		default:
+			return fmt.Errorf("%s.retry_on_errors[%d] must be connect or timeout", field, i)
+		}
+		p.RetryOnErrors[i] = class
+	}
+	return nil
+}
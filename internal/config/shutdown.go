@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	defaultGraceTimeout = 5 * time.Second
+)
+
+type Shutdown struct {
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+	GraceTimeout time.Duration `yaml:"grace_timeout"`
+}
+
+func (c *Config) ShutdownPolicy() Shutdown {
+	policy := Shutdown{DrainTimeout: defaultDrainTimeout, GraceTimeout: defaultGraceTimeout}
+	if c.Shutdown != nil && c.Shutdown.DrainTimeout > 0 {
+		policy.DrainTimeout = c.Shutdown.DrainTimeout
+	}
+	if c.Shutdown != nil && c.Shutdown.GraceTimeout > 0 {
+		policy.GraceTimeout = c.Shutdown.GraceTimeout
+	}
+	return policy
+}
+
+func validateShutdown(s *Shutdown) error {
+	if s == nil {
+		return nil
+	}
+	if s.DrainTimeout < 0 || s.GraceTimeout < 0 {
+		return fmt.Errorf("shutdown timeouts must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import "fmt"
+
+type ModelPrice struct {
+	Input      float64 `yaml:"input"`
+	Output     float64 `yaml:"output"`
+	CacheWrite float64 `yaml:"cache_write"`
+	CacheRead  float64 `yaml:"cache_read"`
+}
+
+type SpendTracking struct {
+	File string `yaml:"file"`
+}
+
+type Budget struct {
+	Daily   float64 `yaml:"daily"`
+	Monthly float64 `yaml:"monthly"`
+}
+
+func (c *Config) PriceFor(model string) (ModelPrice, bool) {
+	price, ok := c.Pricing[model]
+	return price, ok
+}
+
+func validatePricing(pricing map[string]ModelPrice) error {
+	for model, price := range pricing {
+		if price.Input < 0 || price.Output < 0 || price.CacheWrite < 0 || price.CacheRead < 0 {
+			return fmt.Errorf("pricing.%s prices must not be negative", model)
+		}
+	}
+	return nil
+}
+
+func validateBudget(b *Budget, field string) error {
+	if b == nil {
+		return nil
+	}
+	if b.Daily < 0 || b.Monthly < 0 {
+		return fmt.Errorf("%s must not be negative", field)
+	}
+	return nil
+}
+
+func (c *Config) validateBudgetPricing() error {
+	budgeted := -1
+	for i, k := range c.Keys {
+		if k.Budget != nil && (k.Budget.Daily > 0 || k.Budget.Monthly > 0) {
+			budgeted = i
+			break
+		}
+	}
+	if budgeted < 0 {
+		return nil
+	}
+	for i, route := range c.ModelList {
+		for _, p := range route.Upstreams() {
+			if _, ok := c.PriceFor(p.Model); !ok {
+				return fmt.Errorf("model_list[%d] model %s has no pricing entry but keys[%d] has a budget", i, p.Model, budgeted)
+			}
+		}
+	}
+	return nil
+}
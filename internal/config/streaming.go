@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultStreamIdleTimeout = 5 * time.Minute
+
+type Streaming struct {
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	PingInterval time.Duration `yaml:"ping_interval"`
+}
+
+func (c *Config) StreamingPolicy() Streaming {
+	policy := Streaming{IdleTimeout: defaultStreamIdleTimeout}
+	if c.Streaming == nil {
+		return policy
+	}
+	if c.Streaming.IdleTimeout > 0 {
+		policy.IdleTimeout = c.Streaming.IdleTimeout
+	}
+	policy.PingInterval = c.Streaming.PingInterval
+	return policy
+}
+
+func validateStreaming(s *Streaming) error {
+	if s == nil {
+		return nil
+	}
+	if s.IdleTimeout < 0 {
+		return fmt.Errorf("streaming.idle_timeout must not be negative")
+	}
+	if s.PingInterval < 0 {
+		return fmt.Errorf("streaming.ping_interval must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const defaultTracingServiceName = "anthropic-gateway"
+
+type Tracing struct {
+	Endpoint    string            `yaml:"endpoint"`
+	ServiceName string            `yaml:"service_name"`
+	Headers     map[string]string `yaml:"headers"`
+}
+
+func (t *Tracing) TracesURL() string {
+	endpoint := strings.TrimRight(strings.TrimSpace(t.Endpoint), "/")
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+func (c *Config) applyTracingDefaults() {
+	if c.Tracing == nil {
+		return
+	}
+	if strings.TrimSpace(c.Tracing.ServiceName) == "" {
+		c.Tracing.ServiceName = defaultTracingServiceName
+	}
+}
+
+func validateTracing(t *Tracing) error {
+	if t == nil {
+		return nil
+	}
+	if strings.TrimSpace(t.Endpoint) == "" {
+		return fmt.Errorf("tracing.endpoint is required")
+	}
+	u, err := url.Parse(strings.TrimSpace(t.Endpoint))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("tracing.endpoint must be an http/https URL: %s", t.Endpoint)
+	}
+	return nil
+}
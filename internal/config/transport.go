@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultConnectTimeout      = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+type Transport struct {
+	ConnectTimeout        time.Duration `yaml:"connect_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	RequestTimeout        time.Duration `yaml:"request_timeout"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int           `yaml:"max_conns_per_host"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+
+	Proxy              string `yaml:"proxy"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+func (c *Config) TransportFor(route ModelRoute) Transport {
+	settings := Transport{
+		ConnectTimeout:      defaultConnectTimeout,
+		TLSHandshakeTimeout: defaultTLSHandshakeTimeout,
+		MaxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     defaultIdleConnTimeout,
+	}
+	if c.Transport != nil {
+		settings = settings.merge(*c.Transport)
+	}
+	if route.Transport != nil {
+		settings = settings.merge(*route.Transport)
+	}
+	return settings
+}
+
+func (t Transport) merge(override Transport) Transport {
+	if override.ConnectTimeout > 0 {
+		t.ConnectTimeout = override.ConnectTimeout
+	}
+	if override.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = override.TLSHandshakeTimeout
+	}
+	if override.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = override.ResponseHeaderTimeout
+	}
+	if override.RequestTimeout > 0 {
+		t.RequestTimeout = override.RequestTimeout
+	}
+	if override.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = override.MaxIdleConnsPerHost
+	}
+	if override.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = override.MaxConnsPerHost
+	}
+	if override.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = override.IdleConnTimeout
+	}
+	if override.Proxy != "" {
+		t.Proxy = override.Proxy
+	}
+	if override.CAFile != "" {
+		t.CAFile = override.CAFile
+	}
+	if override.CertFile != "" {
+		t.CertFile = override.CertFile
+		t.KeyFile = override.KeyFile
+	}
+	if override.ServerName != "" {
+		t.ServerName = override.ServerName
+	}
+	if override.InsecureSkipVerify {
+		t.InsecureSkipVerify = true
+	}
+	return t
+}
+
+func validateTransport(t *Transport, field string) error {
+	if t == nil {
+		return nil
+	}
+	if t.ConnectTimeout < 0 || t.TLSHandshakeTimeout < 0 || t.ResponseHeaderTimeout < 0 || t.RequestTimeout < 0 || t.IdleConnTimeout < 0 {
+		return fmt.Errorf("%s timeouts must not be negative", field)
+	}
+	if t.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("%s.max_idle_conns_per_host must not be negative", field)
+	}
+	if t.MaxConnsPerHost < 0 {
+		return fmt.Errorf("%s.max_conns_per_host must not be negative", field)
+	}
+	if t.Proxy = strings.TrimSpace(t.Proxy); t.Proxy != "" {
+		u, err := url.Parse(t.Proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("%s.proxy is invalid", field)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("%s.proxy must use http, https, socks5 or socks5h", field)
+		}
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("%s.cert_file and key_file must be set together", field)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+type streamError struct {
+	inner apierrors.Inner
+}
+
+func (e *streamError) Error() string {
+	return e.inner.Type + ": " + e.inner.Message
+}
+
+func (e *streamError) status() int {
+	switch e.inner.Type {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return 529
+	case "timeout_error":
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+type aggregateBlock struct {
+	block     models.ContentBlock
+	text      strings.Builder
+	thinking  strings.Builder
+	signature strings.Builder
+	input     strings.Builder
+}
+
+type messageAggregator struct {
+	message *models.Message
+	blocks  map[int]*aggregateBlock
+	stopped bool
+}
+
+func aggregateStream(r io.Reader) ([]byte, error) {
+	agg := &messageAggregator{blocks: make(map[int]*aggregateBlock)}
+	reader := sse.NewReader(r)
+	for {
+		event, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read upstream stream: %w", err)
+		}
+		if err := agg.add(event); err != nil {
+			return nil, err
+		}
+		if agg.stopped {
+			break
+		}
+	}
+	return agg.result()
+}
+
+func (a *messageAggregator) add(event sse.Event) error {
+	if len(bytes.TrimSpace(event.Data)) == 0 {
+		return nil
+	}
+	var ev models.StreamEvent
+	if err := json.Unmarshal(event.Data, &ev); err != nil {
+		return fmt.Errorf("decode stream event %q: %w", event.Name, err)
+	}
+
+	switch ev.Type {
+	case models.EventMessageStart:
+		if ev.Message == nil {
+			return fmt.Errorf("message_start without message")
+		}
+		a.message = ev.Message
+	case models.EventContentBlockStart:
+		if ev.ContentBlock == nil {
+			return fmt.Errorf("content_block_start without content_block")
+		}
+		block := &aggregateBlock{block: *ev.ContentBlock}
+		block.text.WriteString(ev.ContentBlock.Text)
+		block.thinking.WriteString(ev.ContentBlock.Thinking)
+		block.signature.WriteString(ev.ContentBlock.Signature)
+		a.blocks[ev.Index] = block
+	case models.EventContentBlockDelta:
+		block := a.blocks[ev.Index]
+		if block == nil || ev.Delta == nil {
+			return fmt.Errorf("content_block_delta for unknown block %d", ev.Index)
+		}
+		switch ev.Delta.Type {
+		case "text_delta":
+			block.text.WriteString(ev.Delta.Text)
+		case "input_json_delta":
+			block.input.WriteString(ev.Delta.PartialJSON)
+		case "thinking_delta":
+			block.thinking.WriteString(ev.Delta.Thinking)
+		case "signature_delta":
+			block.signature.WriteString(ev.Delta.Signature)
+		}
+	case models.EventMessageDelta:
+		if a.message == nil {
+			return fmt.Errorf("message_delta before message_start")
+		}
+		if ev.Delta != nil {
+			if ev.Delta.StopReason != nil {
+				a.message.StopReason = ev.Delta.StopReason
+			}
+			if ev.Delta.StopSequence != nil {
+				a.message.StopSequence = ev.Delta.StopSequence
+			}
+		}
+		if ev.Usage != nil {
+			models.MergeUsage(&a.message.Usage, *ev.Usage)
+		}
+	case models.EventMessageStop:
+		a.stopped = true
+	case models.EventError:
+		inner := apierrors.Inner{Type: "api_error", Message: "upstream stream failed"}
+		if ev.Error != nil {
+			inner = *ev.Error
+		}
+		return &streamError{inner: inner}
+	}
+	return nil
+}
+
+func (a *messageAggregator) result() ([]byte, error) {
+	if a.message == nil {
+		return nil, &streamError{inner: apierrors.Inner{Type: "api_error", Message: "upstream stream ended without a message"}}
+	}
+	if !a.stopped {
+		return nil, &streamError{inner: apierrors.Inner{Type: "api_error", Message: "upstream stream ended unexpectedly"}}
+	}
+
+	indexes := make([]int, 0, len(a.blocks))
+	for index := range a.blocks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	content := make([]models.ContentBlock, 0, len(indexes))
+	for _, index := range indexes {
+		b := a.blocks[index]
+		block := b.block
+		switch block.Type {
+		case "text":
+			block.Text = b.text.String()
+		case "thinking":
+			block.Thinking = b.thinking.String()
+			block.Signature = b.signature.String()
+		}
+		if partial := strings.TrimSpace(b.input.String()); partial != "" {
+			if !json.Valid([]byte(partial)) {
+				return nil, fmt.Errorf("tool input for block %d is not valid JSON", index)
+			}
+			block.Input = json.RawMessage(partial)
+		} else if block.Type == "tool_use" && len(block.Input) == 0 {
+			block.Input = json.RawMessage("{}")
+		}
+		content = append(content, block)
+	}
+
+	message := *a.message
+	message.Content = content
+	return json.Marshal(message)
+}
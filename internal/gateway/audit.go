@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"anthropic-gateway/internal/audit"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+type auditEntry struct {
+	logger *audit.Logger
+	rec    audit.Record
+	start  time.Time
+	w      *auditResponseWriter
+}
+
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	capture bool
+	body    bytes.Buffer
+}
+
+func (s *Service) startAudit(w http.ResponseWriter, r *http.Request, payload map[string]any, requestedModel string) (http.ResponseWriter, *auditEntry) {
+	if s.audit == nil {
+		return w, nil
+	}
+
+	entry := &auditEntry{
+		logger: s.audit,
+		start:  time.Now(),
+		w:      &auditResponseWriter{ResponseWriter: w, status: http.StatusOK, capture: s.audit.IncludeBodies()},
+		rec: audit.Record{
+			RequestID:      requestIDFromContext(r.Context()),
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			RequestedModel: requestedModel,
+		},
+	}
+	entry.rec.Stream, _ = payload["stream"].(bool)
+	if key, ok := VirtualKeyFromContext(r.Context()); ok {
+		entry.rec.KeyName = key.Name
+	}
+	if entry.w.capture {
+		if body, err := json.Marshal(payload); err == nil {
+			entry.rec.RequestBody = body
+		}
+	}
+	return entry.w, entry
+}
+
+func (e *auditEntry) setTarget(target upstreamTarget) {
+	if e == nil {
+		return
+	}
+	e.rec.ModelName = target.modelName
+	e.rec.UpstreamModel = target.params.Model
+}
+
+func (e *auditEntry) setUpstreamURL(resp *http.Response) {
+	if e == nil || resp == nil || resp.Request == nil {
+		return
+	}
+	e.rec.UpstreamURL = redactURL(resp.Request.URL)
+}
+
+func (e *auditEntry) setUsage(usage models.Usage) {
+	if e == nil {
+		return
+	}
+	e.rec.Usage = &usage
+}
+
+func (e *auditEntry) finish() {
+	if e == nil {
+		return
+	}
+	e.rec.Time = e.start.UTC()
+	e.rec.Status = e.w.status
+	e.rec.LatencyMS = time.Since(e.start).Milliseconds()
+	if e.w.capture {
+		body := e.w.body.Bytes()
+		if isEventStream(e.w.Header()) {
+			e.rec.ResponseText = streamText(body)
+		} else if json.Valid(body) {
+			e.rec.ResponseBody = body
+		}
+	}
+	e.logger.Write(e.rec)
+}
+
+func (a *auditResponseWriter) WriteHeader(statusCode int) {
+	a.status = statusCode
+	a.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (a *auditResponseWriter) Write(p []byte) (int, error) {
+	if a.capture {
+		a.body.Write(p)
+	}
+	return a.ResponseWriter.Write(p)
+}
+
+func (a *auditResponseWriter) Flush() {
+	if f, ok := a.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func streamText(body []byte) string {
+	var text strings.Builder
+	reader := sse.NewReader(bytes.NewReader(body))
+	for {
+		event, err := reader.Next()
+		if err != nil {
+			return text.String()
+		}
+		var delta struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+		}
+		if json.Unmarshal(event.Data, &delta) != nil {
+			continue
+		}
+		if delta.Type == "content_block_delta" && delta.Delta.Type == "text_delta" {
+			text.WriteString(delta.Delta.Text)
+		}
+	}
+}
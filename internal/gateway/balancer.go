@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"sync"
+
+	"anthropic-gateway/internal/config"
+)
+
+type balancer struct {
+	mu      sync.Mutex
+	current map[string][]int
+}
+
+func newBalancer() *balancer {
+	return &balancer{current: make(map[string][]int)}
+}
+
+func (b *balancer) pick(route config.ModelRoute) int {
+	upstreams := route.Upstreams()
+	if len(upstreams) <= 1 {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := b.current[route.ModelName]
+	if len(current) != len(upstreams) {
+		current = make([]int, len(upstreams))
+		b.current[route.ModelName] = current
+	}
+
+	total := 0
+	best := 0
+	for i, upstream := range upstreams {
+		weight := upstream.EffectiveWeight()
+		current[i] += weight
+		total += weight
+		if current[i] > current[best] {
+			best = i
+		}
+	}
+	current[best] -= total
+	return best
+}
+
+func (b *balancer) order(route config.ModelRoute) []int {
+	n := len(route.Upstreams())
+	first := b.pick(route)
+	order := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		order = append(order, (first+i)%n)
+	}
+	return order
+}
@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"anthropic-gateway/internal/config"
+)
+
+const cacheHeader = "x-gateway-cache"
+
+func cacheBypassed(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get(cacheHeader)), "bypass")
+}
+
+func responseCacheKey(route config.ModelRoute, upstreamPath string, payload map[string]any) (string, bool) {
+	if upstreamPath != "/v1/messages" && upstreamPath != "/v1/messages/count_tokens" {
+		return "", false
+	}
+	body := make(map[string]any, len(payload))
+	for k, v := range payload {
+		if k != "model" && k != "stream" {
+			body[k] = v
+		}
+	}
+	upstreams := route.Upstreams()
+	upstreamModels := make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		upstreamModels = append(upstreamModels, upstream.Model)
+	}
+
+	canonical, err := json.Marshal(struct {
+		ModelName      string         `json:"model_name"`
+		UpstreamModels []string       `json:"upstream_models"`
+		Path           string         `json:"path"`
+		Body           map[string]any `json:"body"`
+	}{route.ModelName, upstreamModels, upstreamPath, body})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), true
+}
@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+	apierrors "anthropic-gateway/internal/errors"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+type circuitOutcome int
+
+const (
+	outcomeSuccess circuitOutcome = iota
+	outcomeFailure
+	outcomeIgnored
+)
+
+type circuitEvent struct {
+	at     time.Time
+	failed bool
+}
+
+type circuit struct {
+	state               string
+	consecutiveFailures int
+	events              []circuitEvent
+	openedAt            time.Time
+	probeInFlight       bool
+}
+
+type circuitBreakers struct {
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+type CircuitStatus struct {
+	ModelName           string     `json:"model_name"`
+	APIBase             string     `json:"api_base"`
+	Model               string     `json:"model"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+func circuitKey(params config.UpstreamParams) string {
+	return params.APIBase + "|" + params.Model
+}
+
+func (b *circuitBreakers) allow(settings *config.CircuitBreaker, key string) bool {
+	if settings == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[key]
+	if !ok {
+		return true
+	}
+	switch c.state {
+	case circuitOpen:
+		if b.now().Sub(c.openedAt) < settings.Cooldown {
+			return false
+		}
+		c.state = circuitHalfOpen
+		c.probeInFlight = true
+		return true
+	case circuitHalfOpen:
+		if c.probeInFlight {
+			return false
+		}
+		c.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreakers) record(settings *config.CircuitBreaker, key string, outcome circuitOutcome) {
+	if settings == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{state: circuitClosed}
+		b.circuits[key] = c
+	}
+	if c.state == circuitOpen {
+		return
+	}
+	now := b.now()
+
+	if outcome == outcomeIgnored {
+		c.probeInFlight = false
+		return
+	}
+	failed := outcome == outcomeFailure
+
+	if c.state == circuitHalfOpen {
+		c.probeInFlight = false
+		if failed {
+			c.state = circuitOpen
+			c.openedAt = now
+			return
+		}
+		c.state = circuitClosed
+		c.consecutiveFailures = 0
+		c.events = c.events[:0]
+		return
+	}
+
+	c.events = append(c.events, circuitEvent{at: now, failed: failed})
+	cutoff := now.Add(-settings.Window)
+	drop := 0
+	for drop < len(c.events) && c.events[drop].at.Before(cutoff) {
+		drop++
+	}
+	c.events = c.events[drop:]
+
+	if !failed {
+		c.consecutiveFailures = 0
+		return
+	}
+	c.consecutiveFailures++
+
+	trip := settings.FailureThreshold > 0 && c.consecutiveFailures >= settings.FailureThreshold
+	if !trip && settings.ErrorRateThreshold > 0 && len(c.events) >= settings.MinRequests {
+		failures := 0
+		for _, event := range c.events {
+			if event.failed {
+				failures++
+			}
+		}
+		trip = float64(failures)/float64(len(c.events)) >= settings.ErrorRateThreshold
+	}
+	if trip {
+		c.state = circuitOpen
+		c.openedAt = now
+	}
+}
+
+func circuitOutcomeFor(ctx context.Context, resp *http.Response, err error) circuitOutcome {
+	if err != nil {
+		if ctx.Err() != nil {
+			return outcomeIgnored
+		}
+		return outcomeFailure
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return outcomeFailure
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return outcomeIgnored
+	}
+	return outcomeSuccess
+}
+
+func (b *circuitBreakers) snapshot(cfg *config.Config) []CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seen := make(map[string]bool)
+	statuses := make([]CircuitStatus, 0)
+	for _, route := range cfg.ModelList {
+		for _, upstream := range route.Upstreams() {
+			key := circuitKey(upstream)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			status := CircuitStatus{
+				ModelName: route.ModelName,
+				APIBase:   upstream.APIBase,
+				Model:     upstream.Model,
+				State:     circuitClosed,
+			}
+			if c, ok := b.circuits[key]; ok {
+				status.State = c.state
+				status.ConsecutiveFailures = c.consecutiveFailures
+				if c.state != circuitClosed {
+					openedAt := c.openedAt
+					status.OpenedAt = &openedAt
+					if cfg.CircuitBreaker != nil {
+						retryAt := openedAt.Add(cfg.CircuitBreaker.Cooldown)
+						status.RetryAt = &retryAt
+					}
+				}
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].ModelName < statuses[j].ModelName
+	})
+	return statuses
+}
+
+func (s *Service) HandleCircuits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	cfg := s.Config()
+	payload := struct {
+		Enabled  bool            `json:"enabled"`
+		Circuits []CircuitStatus `json:"circuits"`
+	}{
+		Enabled:  cfg.CircuitBreaker != nil,
+		Circuits: s.breakers.snapshot(cfg),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		s.logger.Error("failed to encode circuits response", "error", err, "request_id", requestIDFromContext(r.Context()))
+		apierrors.Write(w, http.StatusInternalServerError, "api_error", "failed to encode response", requestIDFromContext(r.Context()))
+	}
+}
@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"anthropic-gateway/internal/adapter"
+	"anthropic-gateway/internal/config"
+)
+
+func TestHalfOpenProbeIsReleasedOnRequestBuildError(t *testing.T) {
+	cfg := &config.Config{
+		CircuitBreaker: &config.CircuitBreaker{FailureThreshold: 1, Cooldown: time.Minute},
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params: config.UpstreamParams{
+					Model:    "anthropic.claude-sonnet-4",
+					APIBase:  "https://bedrock-runtime.us-east-1.amazonaws.com",
+					APIKey:   "k",
+					AuthType: config.AuthTypeBearer,
+					Provider: config.ProviderBedrock,
+				},
+			},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate config: %v", err)
+	}
+	s, err := NewService(cfg, adapter.NewAnthropicCompatibleAdapter(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	s.breakers.now = func() time.Time { return now }
+	route := cfg.ModelList[0]
+	key := circuitKey(route.Params)
+	s.breakers.record(cfg.CircuitBreaker, key, outcomeFailure)
+	if s.breakers.allow(cfg.CircuitBreaker, key) {
+		t.Fatalf("circuit should be open")
+	}
+	now = now.Add(2 * time.Minute)
+
+	r := httptest.NewRequest(http.MethodPost, "/anthropic/v1/messages/count_tokens", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	resp, _ := s.sendUpstream(w, r, cfg, map[string]any{"model": "sonnet"}, route, "/v1/messages/count_tokens")
+	if resp != nil {
+		t.Fatalf("expected no upstream response")
+	}
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d body=%s", w.Code, w.Body)
+	}
+	if !s.breakers.allow(cfg.CircuitBreaker, key) {
+		t.Fatalf("half-open probe was not released")
+	}
+}
+
+func TestOpenCircuitDoesNotConsumeDeploymentRateLimit(t *testing.T) {
+	cfg := &config.Config{
+		CircuitBreaker: &config.CircuitBreaker{FailureThreshold: 1, Cooldown: time.Minute},
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params: config.UpstreamParams{
+					Model:     "glm-5",
+					APIBase:   "https://api.example.com",
+					APIKey:    "k",
+					AuthType:  config.AuthTypeBearer,
+					RateLimit: &config.RateLimit{RequestsPerMinute: 1},
+				},
+			},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate config: %v", err)
+	}
+	s, err := NewService(cfg, adapter.NewAnthropicCompatibleAdapter(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	defer s.Close()
+
+	route := cfg.ModelList[0]
+	s.breakers.record(cfg.CircuitBreaker, circuitKey(route.Params), outcomeFailure)
+
+	r := httptest.NewRequest(http.MethodPost, "/anthropic/v1/messages", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	s.sendUpstream(w, r, cfg, map[string]any{"model": "sonnet"}, route, "/v1/messages")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d body=%s", w.Code, w.Body)
+	}
+	if _, ok := s.limiters.take(deploymentLimiterID(route.Params), route.Params.RateLimit); !ok {
+		t.Fatalf("open circuit consumed the deployment rate limit")
+	}
+}
+
+func TestCancelledRequestDoesNotTripCircuitOrFailOver(t *testing.T) {
+	fallbackCalls := 0
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls++
+	}))
+	defer fallback.Close()
+
+	cfg := &config.Config{
+		CircuitBreaker: &config.CircuitBreaker{FailureThreshold: 1, Cooldown: time.Minute},
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params: config.UpstreamParams{
+					Model:           "claude-sonnet-4@20250514",
+					APIBase:         "https://us-east5-aiplatform.googleapis.com/v1/projects/p/locations/us-east5",
+					AuthType:        config.AuthTypeOAuth,
+					Provider:        config.ProviderVertex,
+					CredentialsFile: filepath.Join(t.TempDir(), "missing.json"),
+				},
+				Fallbacks: []string{"backup"},
+			},
+			{ModelName: "backup", Params: config.UpstreamParams{Model: "glm-5", APIBase: fallback.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate config: %v", err)
+	}
+	s, err := NewService(cfg, adapter.NewAnthropicCompatibleAdapter(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodPost, "/anthropic/v1/messages", strings.NewReader(`{}`)).WithContext(ctx)
+	route := cfg.ModelList[0]
+	resp, _ := s.sendUpstream(httptest.NewRecorder(), r, cfg, map[string]any{"model": "sonnet"}, route, "/v1/messages")
+	if resp != nil {
+		t.Fatalf("expected no upstream response")
+	}
+	if fallbackCalls != 0 {
+		t.Fatalf("fallback called %d times after client went away", fallbackCalls)
+	}
+	if !s.breakers.allow(cfg.CircuitBreaker, circuitKey(route.Params)) {
+		t.Fatalf("cancelled request tripped the circuit")
+	}
+}
+
+func TestCircuitIgnoresLateOutcomesAndRateLimitedProbes(t *testing.T) {
+	settings := &config.CircuitBreaker{FailureThreshold: 1, Cooldown: time.Minute}
+	b := newCircuitBreakers()
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.record(settings, "d", outcomeFailure)
+	now = now.Add(30 * time.Second)
+	b.record(settings, "d", outcomeFailure)
+	now = now.Add(31 * time.Second)
+	if !b.allow(settings, "d") {
+		t.Fatalf("late failure extended the cooldown")
+	}
+
+	limited := &http.Response{StatusCode: http.StatusTooManyRequests}
+	b.record(settings, "d", circuitOutcomeFor(context.Background(), limited, nil))
+	if !b.allow(settings, "d") {
+		t.Fatalf("429 probe did not release the half-open circuit")
+	}
+	b.record(settings, "d", outcomeFailure)
+	if b.allow(settings, "d") {
+		t.Fatalf("429 probe closed the circuit")
+	}
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const drainPollInterval = 50 * time.Millisecond
+
+type drainState struct {
+	draining  atomic.Bool
+	inFlight  atomic.Int64
+	streams   atomic.Int64
+	abort     chan struct{}
+	abortOnce sync.Once
+}
+
+func newDrainState() *drainState {
+	return &drainState{abort: make(chan struct{})}
+}
+
+func (s *Service) Admit() (func(), bool) {
+	s.drain.inFlight.Add(1)
+	if s.drain.draining.Load() {
+		s.drain.inFlight.Add(-1)
+		return nil, false
+	}
+	return func() { s.drain.inFlight.Add(-1) }, true
+}
+
+func (s *Service) Draining() bool {
+	return s.drain.draining.Load()
+}
+
+func (s *Service) OpenStreams() int {
+	return int(s.drain.streams.Load())
+}
+
+func (s *Service) Drain(ctx context.Context) int {
+	s.drain.draining.Store(true)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.drain.inFlight.Load() == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			open := s.OpenStreams()
+			s.drain.abortOnce.Do(func() { close(s.drain.abort) })
+			return open
+		case <-ticker.C:
+		}
+	}
+}
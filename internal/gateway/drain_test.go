@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrainWaitsForEveryAdmittedRequest(t *testing.T) {
+	s := &Service{drain: newDrainState()}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var admitted []func()
+	for range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, ok := s.Admit(); ok {
+				mu.Lock()
+				admitted = append(admitted, release)
+				mu.Unlock()
+			}
+		}()
+	}
+	drained := make(chan struct{})
+	go func() {
+		s.Drain(context.Background())
+		close(drained)
+	}()
+	wg.Wait()
+
+	select {
+	case <-drained:
+		if len(admitted) > 0 {
+			t.Fatalf("drain finished with %d admitted requests in flight", len(admitted))
+		}
+	case <-time.After(2 * drainPollInterval):
+		for _, release := range admitted {
+			release()
+		}
+		<-drained
+	}
+	if _, ok := s.Admit(); ok {
+		t.Fatalf("request admitted after drain")
+	}
+}
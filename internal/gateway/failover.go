@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"anthropic-gateway/internal/config"
+)
+
+type upstreamTarget struct {
+	modelName string
+	params    config.UpstreamParams
+	transport config.Transport
+}
+
+func (s *Service) upstreamTargets(cfg *config.Config, route config.ModelRoute) []upstreamTarget {
+	targets := s.routeTargets(cfg, route)
+	for _, fallback := range route.Fallbacks {
+		fallbackRoute, ok := cfg.RouteByModel(fallback)
+		if !ok {
+			continue
+		}
+		targets = append(targets, s.routeTargets(cfg, fallbackRoute)...)
+	}
+	return targets
+}
+
+func (s *Service) routeTargets(cfg *config.Config, route config.ModelRoute) []upstreamTarget {
+	upstreams := route.Upstreams()
+	transport := cfg.TransportFor(route)
+	targets := make([]upstreamTarget, 0, len(upstreams))
+	for _, idx := range s.balancer.order(route) {
+		targets = append(targets, upstreamTarget{modelName: route.ModelName, params: upstreams[idx], transport: transport})
+	}
+	return targets
+}
+
+const maxFailureBody = 1 << 20
+
+type upstreamFailure struct {
+	target upstreamTarget
+	resp   *http.Response
+	err    error
+}
+
+func (f *upstreamFailure) keep(target upstreamTarget, resp *http.Response, err error) {
+	f.discard()
+	if resp != nil {
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxFailureBody))
+		resp.Body.Close()
+		if readErr != nil {
+			resp, err = nil, readErr
+		} else {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+		}
+	}
+	f.target, f.resp, f.err = target, resp, err
+}
+
+func (f *upstreamFailure) discard() {
+	if f.resp != nil {
+		f.resp.Body.Close()
+		f.resp = nil
+	}
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"anthropic-gateway/internal/metrics"
+	"anthropic-gateway/internal/models"
+)
+
+type Metrics struct {
+	registry       *metrics.Registry
+	requests       *metrics.Counter
+	duration       *metrics.Histogram
+	firstByte      *metrics.Histogram
+	inFlight       *metrics.Gauge
+	upstreamErrors *metrics.Counter
+	inputTokens    *metrics.Counter
+	outputTokens   *metrics.Counter
+	cacheRequests  *metrics.Counter
+}
+
+type requestLabels struct {
+	modelName     string
+	upstreamModel string
+}
+
+func newMetrics() *Metrics {
+	registry := metrics.NewRegistry()
+	return &Metrics{
+		registry:       registry,
+		requests:       registry.Counter("gateway_requests_total", "HTTP requests served, by route, model and status.", "route", "model_name", "upstream_model", "status"),
+		duration:       registry.Histogram("gateway_request_duration_seconds", "Time to serve an HTTP request, including the full stream body.", metrics.DefaultBuckets, "route", "model_name", "upstream_model", "status"),
+		firstByte:      registry.Histogram("gateway_stream_time_to_first_byte_seconds", "Time from request start to the first streamed body byte.", metrics.DefaultBuckets, "route", "model_name", "upstream_model"),
+		inFlight:       registry.Gauge("gateway_requests_in_flight", "HTTP requests currently being served."),
+		upstreamErrors: registry.Counter("gateway_upstream_errors_total", "Failed upstream attempts, by class (timeout, connect, 4xx, 5xx).", "model_name", "upstream_model", "class"),
+		inputTokens:    registry.Counter("gateway_input_tokens_total", "Input tokens reported by upstream responses.", "model_name", "upstream_model"),
+		outputTokens:   registry.Counter("gateway_output_tokens_total", "Output tokens reported by upstream responses.", "model_name", "upstream_model"),
+		cacheRequests:  registry.Counter("gateway_cache_requests_total", "Response cache lookups, by result (hit, miss, bypass).", "model_name", "result"),
+	}
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.registry.ServeHTTP(w, r)
+}
+
+func (m *Metrics) StartRequest(ctx context.Context) (context.Context, func()) {
+	m.inFlight.Add(1)
+	return context.WithValue(ctx, contextKeyRequestLabels, &requestLabels{}), func() { m.inFlight.Add(-1) }
+}
+
+func (m *Metrics) ObserveRequest(ctx context.Context, route string, status int, duration, firstByte time.Duration) {
+	labels := requestLabelsFromContext(ctx)
+	statusLabel := strconv.Itoa(status)
+	m.requests.Inc(route, labels.modelName, labels.upstreamModel, statusLabel)
+	m.duration.Observe(duration.Seconds(), route, labels.modelName, labels.upstreamModel, statusLabel)
+	if firstByte > 0 {
+		m.firstByte.Observe(firstByte.Seconds(), route, labels.modelName, labels.upstreamModel)
+	}
+}
+
+func (m *Metrics) observeUpstreamError(target upstreamTarget, class string) {
+	m.upstreamErrors.Inc(target.modelName, target.params.Model, class)
+}
+
+func (m *Metrics) observeUsage(target upstreamTarget, usage models.Usage) {
+	m.inputTokens.Add(float64(usage.InputTokens), target.modelName, target.params.Model)
+	m.outputTokens.Add(float64(usage.OutputTokens), target.modelName, target.params.Model)
+}
+
+func (m *Metrics) observeCache(modelName, result string) {
+	m.cacheRequests.Inc(modelName, result)
+}
+
+func upstreamErrorClass(ctx context.Context, resp *http.Response, err error) string {
+	switch {
+	case err != nil:
+		if ctx.Err() != nil {
+			return ""
+		}
+		class := classifyError(err)
+		if class == errorClassCanceled {
+			return ""
+		}
+		return class
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return "5xx"
+	case resp.StatusCode >= http.StatusBadRequest:
+		return "4xx"
+	}
+	return ""
+}
+
+func setRequestLabels(ctx context.Context, modelName, upstreamModel string) {
+	if labels, ok := ctx.Value(contextKeyRequestLabels).(*requestLabels); ok {
+		labels.modelName = modelName
+		labels.upstreamModel = upstreamModel
+	}
+}
+
+func requestLabelsFromContext(ctx context.Context) requestLabels {
+	if labels, ok := ctx.Value(contextKeyRequestLabels).(*requestLabels); ok {
+		return *labels
+	}
+	return requestLabels{}
+}
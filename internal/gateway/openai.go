@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"anthropic-gateway/internal/adapter"
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+func (s *Service) HandleOpenAIChatCompletions(w http.ResponseWriter, r *http.Request) {
+	ow := newOpenAIResponseWriter(w)
+	defer ow.finish()
+
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(ow, r, http.MethodPost)
+		return
+	}
+
+	body, ok := readRequestBody(ow, r)
+	if !ok {
+		return
+	}
+
+	payload, opts, err := adapter.OpenAIRequestToMessages(body)
+	if err != nil {
+		message := "failed to convert request"
+		if errors.Is(err, adapter.ErrInvalidRequest) {
+			message = err.Error()
+		}
+		apierrors.Write(ow, http.StatusBadRequest, "invalid_request_error", message, requestIDFromContext(r.Context()))
+		return
+	}
+	ow.model = opts.Model
+	ow.includeUsage = opts.IncludeUsage
+
+	s.proxy(ow, r, payload, "/v1/messages")
+}
+
+func (s *Service) HandleOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ow := newOpenAIResponseWriter(w)
+		defer ow.finish()
+		writeMethodNotAllowed(ow, r, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(models.BuildOpenAIListResponse(s.Config())); err != nil {
+		s.logger.Error("failed to encode models response", "error", err, "request_id", requestIDFromContext(r.Context()))
+	}
+}
+
+func (s *Service) HandleOpenAIUnsupported(w http.ResponseWriter, r *http.Request) {
+	ow := newOpenAIResponseWriter(w)
+	defer ow.finish()
+	s.HandleUnsupported(ow, r)
+}
+
+type openAIResponseWriter struct {
+	w            http.ResponseWriter
+	statusCode   int
+	wroteHeader  bool
+	streaming    bool
+	buf          bytes.Buffer
+	encoder      *adapter.OpenAIStreamEncoder
+	model        string
+	includeUsage bool
+}
+
+func newOpenAIResponseWriter(w http.ResponseWriter) *openAIResponseWriter {
+	return &openAIResponseWriter{w: w, statusCode: http.StatusOK}
+}
+
+func (o *openAIResponseWriter) Header() http.Header {
+	return o.w.Header()
+}
+
+func (o *openAIResponseWriter) WriteHeader(statusCode int) {
+	if o.wroteHeader {
+		return
+	}
+	o.wroteHeader = true
+	o.statusCode = statusCode
+	if statusCode < http.StatusBadRequest && isEventStream(o.w.Header()) {
+		o.streaming = true
+		o.encoder = adapter.NewOpenAIStreamEncoder(o.model, o.includeUsage)
+		o.w.WriteHeader(statusCode)
+	}
+}
+
+func (o *openAIResponseWriter) Write(p []byte) (int, error) {
+	if !o.wroteHeader {
+		o.WriteHeader(http.StatusOK)
+	}
+	if !o.streaming {
+		return o.buf.Write(p)
+	}
+
+	o.buf.Write(bytes.ReplaceAll(p, []byte("\r"), nil))
+	for {
+		idx := bytes.Index(o.buf.Bytes(), []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		frame := o.buf.Next(idx + 2)
+		event, err := sse.NewReader(bytes.NewReader(frame)).Next()
+		if err != nil {
+			continue
+		}
+		if out := o.encoder.Encode(event); len(out) > 0 {
+			if _, err := o.w.Write(out); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (o *openAIResponseWriter) Flush() {
+	if !o.streaming {
+		return
+	}
+	if f, ok := o.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (o *openAIResponseWriter) finish() {
+	if o.streaming {
+		return
+	}
+
+	statusCode := o.statusCode
+	var out []byte
+	if statusCode >= http.StatusBadRequest {
+		out = adapter.ErrorToOpenAI(o.buf.Bytes(), statusCode)
+	} else {
+		converted, err := adapter.MessageToOpenAIResponse(o.buf.Bytes(), o.model)
+		if err != nil {
+			statusCode = http.StatusBadGateway
+			converted = adapter.MarshalOpenAIError("api_error", "failed to translate upstream response")
+		}
+		out = converted
+	}
+
+	for key := range o.w.Header() {
+		if strings.HasPrefix(strings.ToLower(key), "anthropic-") {
+			o.w.Header().Del(key)
+		}
+	}
+	o.w.Header().Set("Content-Type", "application/json")
+	o.w.WriteHeader(statusCode)
+	_, _ = o.w.Write(out)
+}
@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/models"
+)
+
+type rateBucket struct {
+	capacity float64
+	tokens   float64
+	updated  time.Time
+}
+
+func newRateBucket(perMinute int, now time.Time) rateBucket {
+	return rateBucket{capacity: float64(perMinute), tokens: float64(perMinute), updated: now}
+}
+
+func (b *rateBucket) enabled() bool {
+	return b.capacity > 0
+}
+
+func (b *rateBucket) refill(now time.Time) {
+	if !b.enabled() {
+		return
+	}
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.capacity/60)
+	}
+	b.updated = now
+}
+
+func (b *rateBucket) waitFor(need float64) time.Duration {
+	if !b.enabled() || b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / (b.capacity / 60) * float64(time.Second))
+}
+
+type rateLimiter struct {
+	limit    config.RateLimit
+	requests rateBucket
+	input    rateBucket
+	output   rateBucket
+}
+
+type rateLimitStatus struct {
+	requests   rateBucket
+	input      rateBucket
+	output     rateBucket
+	now        time.Time
+	retryAfter time.Duration
+}
+
+type rateLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+	now      func() time.Time
+}
+
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{
+		limiters: make(map[string]*rateLimiter),
+		now:      time.Now,
+	}
+}
+
+func keyLimiterID(key config.VirtualKey) string {
+	return "key|" + key.Name
+}
+
+func deploymentLimiterID(params config.UpstreamParams) string {
+	return "deployment|" + circuitKey(params)
+}
+
+func (l *rateLimiters) limiter(id string, limit config.RateLimit, now time.Time) *rateLimiter {
+	rl, ok := l.limiters[id]
+	if !ok || rl.limit != limit {
+		rl = &rateLimiter{
+			limit:    limit,
+			requests: newRateBucket(limit.RequestsPerMinute, now),
+			input:    newRateBucket(limit.InputTokensPerMinute, now),
+			output:   newRateBucket(limit.OutputTokensPerMinute, now),
+		}
+		l.limiters[id] = rl
+	}
+	rl.requests.refill(now)
+	rl.input.refill(now)
+	rl.output.refill(now)
+	return rl
+}
+
+func (l *rateLimiters) take(id string, limit *config.RateLimit) (rateLimitStatus, bool) {
+	if limit == nil {
+		return rateLimitStatus{}, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rl := l.limiter(id, *limit, now)
+	wait := max(rl.requests.waitFor(1), rl.input.waitFor(1), rl.output.waitFor(1))
+	if wait > 0 {
+		return rl.status(now, wait), false
+	}
+	if rl.requests.enabled() {
+		rl.requests.tokens--
+	}
+	return rl.status(now, 0), true
+}
+
+func (l *rateLimiters) consume(id string, limit *config.RateLimit, usage models.Usage) {
+	if limit == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rl := l.limiter(id, *limit, l.now())
+	if rl.input.enabled() {
+		rl.input.tokens -= float64(usage.InputTokens + usage.CacheCreationInputTokens)
+	}
+	if rl.output.enabled() {
+		rl.output.tokens -= float64(usage.OutputTokens)
+	}
+}
+
+func (rl *rateLimiter) status(now time.Time, retryAfter time.Duration) rateLimitStatus {
+	return rateLimitStatus{
+		requests:   rl.requests,
+		input:      rl.input,
+		output:     rl.output,
+		now:        now,
+		retryAfter: retryAfter,
+	}
+}
+
+func (st rateLimitStatus) apply(h http.Header) {
+	st.applyBucket(h, "requests", st.requests)
+	st.applyBucket(h, "input-tokens", st.input)
+	st.applyBucket(h, "output-tokens", st.output)
+	if st.retryAfter > 0 {
+		setRetryAfter(h, st.retryAfter)
+	}
+}
+
+func setRetryAfter(h http.Header, wait time.Duration) {
+	h.Set("retry-after", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+}
+
+func (st rateLimitStatus) applyBucket(h http.Header, name string, b rateBucket) {
+	if !b.enabled() {
+		return
+	}
+	remaining := max(int(math.Floor(b.tokens)), 0)
+	reset := st.now.Add(b.waitFor(b.capacity)).UTC().Format(time.RFC3339)
+	h.Set("anthropic-ratelimit-"+name+"-limit", strconv.Itoa(int(b.capacity)))
+	h.Set("anthropic-ratelimit-"+name+"-remaining", strconv.Itoa(remaining))
+	h.Set("anthropic-ratelimit-"+name+"-reset", reset)
+}
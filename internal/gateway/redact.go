@@ -0,0 +1,30 @@
+package gateway
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	query := redacted.Query()
+	if query.Has("key") {
+		query.Set("key", "REDACTED")
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+func redactError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), urlErr.URL, redactURL(u)))
+}
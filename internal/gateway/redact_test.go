@@ -0,0 +1,21 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactErrorHidesQueryKey(t *testing.T) {
+	err := fmt.Errorf("send: %w", &url.Error{
+		Op:  "Post",
+		URL: "https://generativelanguage.googleapis.com/v1beta/models/gemini:generateContent?key=secret",
+		Err: errors.New("connection refused"),
+	})
+	got := redactError(err).Error()
+	if strings.Contains(got, "secret") || !strings.Contains(got, "key=REDACTED") || !strings.Contains(got, "connection refused") {
+		t.Fatalf("redacted error = %q", got)
+	}
+}
@@ -0,0 +1,34 @@
+package gateway
+
+import (
+	"reflect"
+
+	"anthropic-gateway/internal/config"
+)
+
+func (s *Service) Reload(next *config.Config) ([]string, error) {
+	transports, err := buildTransports(next)
+	if err != nil {
+		return nil, err
+	}
+	s.clients.replace(transports)
+	prev := s.cfg.Swap(next)
+
+	var restart []string
+	if !reflect.DeepEqual(prev.Listen, next.Listen) {
+		restart = append(restart, "listen")
+	}
+	if !reflect.DeepEqual(prev.Spend, next.Spend) {
+		restart = append(restart, "spend")
+	}
+	if !reflect.DeepEqual(prev.Tracing, next.Tracing) {
+		restart = append(restart, "tracing")
+	}
+	if !reflect.DeepEqual(prev.Audit, next.Audit) {
+		restart = append(restart, "audit")
+	}
+	if !reflect.DeepEqual(prev.Cache, next.Cache) {
+		restart = append(restart, "cache")
+	}
+	return restart, nil
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"anthropic-gateway/internal/config"
+)
+
+const (
+	errorClassCanceled = "canceled"
+	errorClassTimeout  = config.RetryOnTimeout
+	errorClassConnect  = config.RetryOnConnect
+)
+
+func classifyError(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return errorClassCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorClassTimeout
+	}
+	return errorClassConnect
+}
+
+func backoffDelay(policy config.RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseBackoff
+	for i := 1; i < attempt && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+	if policy.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * policy.Jitter
+		delay += time.Duration((rand.Float64()*2 - 1) * spread)
+	}
+	if delay > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+func retryAfter(headers http.Header) (time.Duration, bool) {
+	if v := strings.TrimSpace(headers.Get("retry-after-ms")); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+
+	v := strings.TrimSpace(headers.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -5,38 +5,112 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
-	"net"
+	"maps"
 	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"anthropic-gateway/internal/adapter"
+	"anthropic-gateway/internal/audit"
+	"anthropic-gateway/internal/cache"
 	"anthropic-gateway/internal/config"
 	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/spend"
+	"anthropic-gateway/internal/tracing"
 )
 
 const (
-	contextKeyRequestID = "request_id"
+	contextKeyRequestID  = "request_id"
+	contextKeyVirtualKey = "virtual_key"
+
+	contextKeyRequestLabels = "request_labels"
 )
 
 type Service struct {
-	cfg     *config.Config
-	adapter adapter.Adapter
-	client  *http.Client
-	logger  *slog.Logger
+	cfg      atomic.Pointer[config.Config]
+	adapter  adapter.Adapter
+	adapters map[string]adapter.Adapter
+	clients  *transportPool
+	logger   *slog.Logger
+	balancer *balancer
+	breakers *circuitBreakers
+	limiters *rateLimiters
+	spend    *spend.Tracker
+	metrics  *Metrics
+	tracer   *tracing.Tracer
+	audit    *audit.Logger
+	cache    *cache.Cache
+	drain    *drainState
 }
 
-func NewService(cfg *config.Config, ad adapter.Adapter, logger *slog.Logger) *Service {
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	client := &http.Client{Transport: transport}
+func NewService(cfg *config.Config, ad adapter.Adapter, logger *slog.Logger) (*Service, error) {
+	transports, err := buildTransports(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	spendFile := ""
+	if cfg.Spend != nil {
+		spendFile = cfg.Spend.File
+	}
+	tracker, err := spend.Open(spendFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	auditLog, err := audit.Open(cfg.Audit, logger)
+	if err != nil {
+		return nil, err
+	}
+	responseCache, err := cache.Open(cfg.Cache, logger)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Service{
-		cfg:     cfg,
+	s := &Service{
 		adapter: ad,
-		client:  client,
-		logger:  logger,
+		adapters: map[string]adapter.Adapter{
+			config.ProviderAnthropic: ad,
+			config.ProviderOpenAI:    adapter.NewOpenAIAdapter(),
+			config.ProviderGemini:    adapter.NewGeminiAdapter(),
+			config.ProviderBedrock:   adapter.NewBedrockAdapter(),
+			config.ProviderVertex:    adapter.NewVertexAdapter(),
+		},
+		clients:  newTransportPool(transports),
+		logger:   logger,
+		balancer: newBalancer(),
+		breakers: newCircuitBreakers(),
+		limiters: newRateLimiters(),
+		spend:    tracker,
+		metrics:  newMetrics(),
+		tracer:   tracing.New(cfg.Tracing, logger),
+		audit:    auditLog,
+		cache:    responseCache,
+		drain:    newDrainState(),
 	}
+	s.cfg.Store(cfg)
+	return s, nil
+}
+
+func (s *Service) Config() *config.Config {
+	return s.cfg.Load()
+}
+
+func (s *Service) Metrics() *Metrics {
+	return s.metrics
+}
+
+func (s *Service) Tracer() *tracing.Tracer {
+	return s.tracer
+}
+
+func (s *Service) Close() error {
+	s.clients.closeIdle()
+	return errors.Join(s.spend.Close(), s.tracer.Close(), s.audit.Close())
 }
 
 func (s *Service) HandleMessages(w http.ResponseWriter, r *http.Request) {
@@ -62,7 +136,7 @@ func (s *Service) HandleModels(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(s.adapter.BuildModelsResponse(s.cfg)); err != nil {
+	if err := json.NewEncoder(w).Encode(s.adapter.BuildModelsResponse(s.Config())); err != nil {
 		s.logger.Error("failed to encode models response", "error", err, "request_id", requestIDFromContext(r.Context()))
 		apierrors.Write(w, http.StatusInternalServerError, "api_error", "failed to encode response", requestIDFromContext(r.Context()))
 		return
@@ -82,14 +156,8 @@ func (s *Service) HandleUnsupported(w http.ResponseWriter, r *http.Request) {
 func (s *Service) proxyJSON(w http.ResponseWriter, r *http.Request) {
 	requestID := requestIDFromContext(r.Context())
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		var maxErr *http.MaxBytesError
-		if errors.As(err, &maxErr) {
-			apierrors.Write(w, http.StatusRequestEntityTooLarge, "invalid_request_error", "request body too large", requestID)
-			return
-		}
-		apierrors.Write(w, http.StatusBadRequest, "invalid_request_error", "failed to read request body", requestID)
+	body, ok := readRequestBody(w, r)
+	if !ok {
 		return
 	}
 
@@ -99,125 +167,527 @@ func (s *Service) proxyJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.proxy(w, r, payload, strings.TrimPrefix(r.URL.Path, "/anthropic"))
+}
+
+func (s *Service) proxy(w http.ResponseWriter, r *http.Request, payload map[string]any, upstreamPath string) {
+	requestID := requestIDFromContext(r.Context())
+	cfg := s.Config()
+
 	requestedModel, ok := payload["model"].(string)
+	w, entry := s.startAudit(w, r, payload, requestedModel)
+	defer entry.finish()
 	if !ok || strings.TrimSpace(requestedModel) == "" {
 		apierrors.Write(w, http.StatusBadRequest, "invalid_request_error", "model is required", requestID)
 		return
 	}
 
-	route, found := s.cfg.RouteByModel(requestedModel)
+	_, routeSpan := s.tracer.Start(r.Context(), "resolve route", tracing.KindInternal)
+	routeSpan.SetAttr("gateway.requested_model", requestedModel)
+	route, found := cfg.RouteByModel(requestedModel)
+	routeSpan.SetAttr("gateway.route_found", found)
+	if found {
+		routeSpan.SetAttr("gateway.model_name", route.ModelName)
+		routeSpan.SetAttr("gateway.deployments", len(route.Upstreams()))
+		routeSpan.SetAttr("gateway.fallbacks", len(route.Fallbacks))
+	}
+	routeSpan.End()
 	if !found {
 		apierrors.Write(w, http.StatusBadRequest, "invalid_request_error", "unknown model: "+requestedModel, requestID)
 		return
 	}
+	setRequestLabels(r.Context(), route.ModelName, "")
+	span := tracing.SpanFromContext(r.Context())
+	span.SetAttr("gateway.model_name", route.ModelName)
 
-	payload["model"] = route.Params.Model
-	mutatedBody, err := json.Marshal(payload)
-	if err != nil {
-		apierrors.Write(w, http.StatusBadRequest, "invalid_request_error", "failed to marshal request payload", requestID)
-		return
+	key, hasKey := VirtualKeyFromContext(r.Context())
+	if hasKey {
+		span.SetAttr("gateway.key_name", key.Name)
 	}
-
-	upstreamPath := strings.TrimPrefix(r.URL.Path, "/anthropic")
-	upstreamURL, err := s.adapter.BuildUpstreamURL(route.Params.APIBase, upstreamPath, r.URL.RawQuery)
-	if err != nil {
-		s.logger.Error("failed to build upstream URL", "error", err, "request_id", requestID)
-		apierrors.Write(w, http.StatusInternalServerError, "api_error", "failed to build upstream request", requestID)
+	if hasKey && !key.AllowsModel(route.ModelName) {
+		apierrors.Write(w, http.StatusForbidden, "permission_error", "API key is not allowed to use model: "+route.ModelName, requestID)
 		return
 	}
 
-	upReq, err := http.NewRequestWithContext(r.Context(), r.Method, upstreamURL, bytes.NewReader(mutatedBody))
-	if err != nil {
-		s.logger.Error("failed to build upstream request", "error", err, "request_id", requestID)
-		apierrors.Write(w, http.StatusInternalServerError, "api_error", "failed to build upstream request", requestID)
-		return
+	var keyLimit rateLimitStatus
+	if hasKey {
+		if period, budget, exceeded := s.spend.BudgetExceeded(key.Name, key.Budget); exceeded {
+			apierrors.Write(w, http.StatusForbidden, "permission_error", fmt.Sprintf("API key %s has exhausted its %s budget of $%.2f", key.Name, period, budget), requestID)
+			return
+		}
+
+		status, ok := s.limiters.take(keyLimiterID(key), key.RateLimit)
+		if !ok {
+			status.apply(w.Header())
+			apierrors.Write(w, http.StatusTooManyRequests, "rate_limit_error", "rate limit exceeded for API key: "+key.Name, requestID)
+			return
+		}
+		keyLimit = status
 	}
 
-	copyRequestHeaders(upReq.Header, r.Header)
-	s.adapter.ApplyAuthHeaders(upReq.Header, route.Params)
-	if upReq.Header.Get("Content-Type") == "" {
-		upReq.Header.Set("Content-Type", "application/json")
+	clientStream, _ := payload["stream"].(bool)
+	clientStream = clientStream && upstreamPath == "/v1/messages"
+
+	var cacheKey string
+	cacheable := false
+	if s.cache != nil {
+		if cacheBypassed(r) {
+			s.metrics.observeCache(route.ModelName, "bypass")
+		} else if cacheKey, cacheable = responseCacheKey(route, upstreamPath, payload); cacheable {
+			if cached, ok := s.cache.Get(cacheKey); ok {
+				s.metrics.observeCache(route.ModelName, "hit")
+				entry.setTarget(upstreamTarget{modelName: route.ModelName})
+				w.Header().Set(cacheHeader, "hit")
+				keyLimit.apply(w.Header())
+				s.writeMessage(r.Context(), w, cached.Status, cached.Body, clientStream, requestID)
+				return
+			}
+			s.metrics.observeCache(route.ModelName, "miss")
+			w.Header().Set(cacheHeader, "miss")
+		}
 	}
 
-	resp, err := s.client.Do(upReq)
-	if err != nil {
-		s.handleUpstreamFailure(w, err, requestID)
+	resp, target := s.sendUpstream(w, r, cfg, payload, route, upstreamPath)
+	if target.modelName != "" {
+		setRequestLabels(r.Context(), target.modelName, target.params.Model)
+		span.SetAttr("gateway.model_name", target.modelName)
+		span.SetAttr("gen_ai.request.model", target.params.Model)
+		entry.setTarget(target)
+	}
+	if resp == nil {
 		return
 	}
+	entry.setUpstreamURL(resp)
+	ad := s.adapterFor(target.params)
 	defer resp.Body.Close()
 
 	copyResponseHeaders(w.Header(), resp.Header)
+	keyLimit.apply(w.Header())
 
+	var translated []byte
 	if isEventStream(resp.Header) {
-		w.WriteHeader(resp.StatusCode)
-		s.streamResponse(w, resp.Body, requestID)
+		stream := ad.TranslateStream(resp.Body)
+		defer stream.Close()
+		if clientStream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(resp.StatusCode)
+			recorder := &streamUsageRecorder{}
+			_, streamSpan := s.tracer.Start(r.Context(), "stream response", tracing.KindInternal)
+			body := struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(stream, recorder), stream}
+			if err := s.streamResponse(r.Context(), w, body, cfg.StreamingPolicy(), requestID); err != nil && !errors.Is(err, context.Canceled) {
+				streamSpan.SetError(err.Error())
+			}
+			if usage, ok := recorder.Usage(); ok {
+				s.recordUsage(r.Context(), cfg, target, usage)
+				setUsageAttrs(streamSpan, usage)
+				entry.setUsage(usage)
+			}
+			streamSpan.End()
+			return
+		}
+
+		_, aggregateSpan := s.tracer.Start(r.Context(), "aggregate stream", tracing.KindInternal)
+		aggregated, err := aggregateStream(stream)
+		if err != nil {
+			aggregateSpan.SetError(err.Error())
+			aggregateSpan.End()
+			var upstreamErr *streamError
+			if errors.As(err, &upstreamErr) {
+				apierrors.Write(w, upstreamErr.status(), upstreamErr.inner.Type, upstreamErr.inner.Message, requestID)
+				return
+			}
+			s.logger.Error("failed to aggregate upstream stream", "error", err, "request_id", requestID)
+			apierrors.Write(w, http.StatusBadGateway, "api_error", "failed to translate upstream response", requestID)
+			return
+		}
+		aggregateSpan.End()
+		translated = aggregated
+	} else {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil && classifyError(err) == errorClassTimeout && r.Context().Err() == nil {
+			s.handleUpstreamFailure(w, err, target.transport, requestID)
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to read upstream response", "error", err, "request_id", requestID)
+			apierrors.Write(w, http.StatusBadGateway, "api_error", "failed to read upstream response", requestID)
+			return
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			normalized := ad.NormalizeUpstreamError(resp.StatusCode, respBody, requestID)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(resp.StatusCode)
+			_, _ = w.Write(normalized)
+			return
+		}
+
+		translated, err = ad.TranslateResponse(respBody)
+		if err != nil {
+			s.logger.Error("failed to translate upstream response", "error", err, "request_id", requestID)
+			apierrors.Write(w, http.StatusBadGateway, "api_error", "failed to translate upstream response", requestID)
+			return
+		}
+	}
+
+	if usage, ok := usageFromMessage(translated); ok {
+		s.recordUsage(r.Context(), cfg, target, usage)
+		entry.setUsage(usage)
+	}
+	if cacheable {
+		s.cache.Set(cacheKey, cache.Entry{Status: resp.StatusCode, Body: translated})
+	}
+	s.writeMessage(r.Context(), w, resp.StatusCode, translated, clientStream, requestID)
+}
+
+func (s *Service) writeMessage(ctx context.Context, w http.ResponseWriter, status int, body []byte, stream bool, requestID string) {
+	if !stream {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
 		return
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
+	synthesized, err := adapter.MessageToStream(body)
 	if err != nil {
-		s.logger.Error("failed to read upstream response", "error", err, "request_id", requestID)
-		apierrors.Write(w, http.StatusBadGateway, "api_error", "failed to read upstream response", requestID)
+		s.logger.Error("failed to synthesize stream from message", "error", err, "request_id", requestID)
+		apierrors.Write(w, http.StatusBadGateway, "api_error", "failed to translate upstream response", requestID)
 		return
 	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(status)
+	_ = s.streamResponse(ctx, w, io.NopCloser(bytes.NewReader(synthesized)), config.Streaming{}, requestID)
+}
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		normalized := s.adapter.NormalizeUpstreamError(resp.StatusCode, respBody, requestID)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(resp.StatusCode)
-		_, _ = w.Write(normalized)
-		return
+func upstreamStreams(payload map[string]any, params config.UpstreamParams, upstreamPath string) bool {
+	stream, _ := payload["stream"].(bool)
+	switch {
+	case stream && params.ForceNonStreaming:
+		return false
+	case !stream && params.ForceStreaming && upstreamPath == "/v1/messages":
+		return true
+	}
+	return stream
+}
+
+func (s *Service) recordUsage(ctx context.Context, cfg *config.Config, target upstreamTarget, usage models.Usage) {
+	keyName := ""
+	if key, ok := VirtualKeyFromContext(ctx); ok {
+		keyName = key.Name
+		s.limiters.consume(keyLimiterID(key), key.RateLimit, usage)
+	}
+	s.limiters.consume(deploymentLimiterID(target.params), target.params.RateLimit, usage)
+	s.metrics.observeUsage(target, usage)
+	setUsageAttrs(tracing.SpanFromContext(ctx), usage)
+
+	cost := 0.0
+	if price, ok := cfg.PriceFor(target.params.Model); ok {
+		cost = spend.Cost(price, usage)
+	}
+	s.spend.Record(keyName, target.modelName, usage, cost)
+}
+
+func (s *Service) sendUpstream(w http.ResponseWriter, r *http.Request, cfg *config.Config, payload map[string]any, route config.ModelRoute, upstreamPath string) (*http.Response, upstreamTarget) {
+	requestID := requestIDFromContext(r.Context())
+	policy := cfg.RetryPolicyFor(route)
+	targets := s.upstreamTargets(cfg, route)
+
+	var limited *rateLimitStatus
+	var unusable upstreamTarget
+	var unusableErr error
+	var failed upstreamFailure
+	defer failed.discard()
+	for i, target := range targets {
+		lastTarget := i == len(targets)-1
+		key := circuitKey(target.params)
+
+		for attempt := 1; ; attempt++ {
+			if !s.breakers.allow(cfg.CircuitBreaker, key) {
+				s.logger.Warn(
+					"skipping upstream deployment with open circuit",
+					"model_name", target.modelName,
+					"upstream_model", target.params.Model,
+					"api_base", target.params.APIBase,
+					"request_id", requestID,
+				)
+				break
+			}
+			if status, ok := s.limiters.take(deploymentLimiterID(target.params), target.params.RateLimit); !ok {
+				s.logger.Warn(
+					"skipping rate limited upstream deployment",
+					"model_name", target.modelName,
+					"upstream_model", target.params.Model,
+					"api_base", target.params.APIBase,
+					"request_id", requestID,
+				)
+				s.breakers.record(cfg.CircuitBreaker, key, outcomeIgnored)
+				if limited == nil || status.retryAfter < limited.retryAfter {
+					limited = &status
+				}
+				break
+			}
+
+			attemptCtx, attemptSpan := s.tracer.Start(r.Context(), "upstream attempt", tracing.KindClient)
+			attemptSpan.SetAttr("gateway.model_name", target.modelName)
+			attemptSpan.SetAttr("gen_ai.request.model", target.params.Model)
+			attemptSpan.SetAttr("gateway.provider", target.params.Provider)
+			attemptSpan.SetAttr("gateway.attempt", attempt)
+			attemptSpan.SetAttr("server.address", target.params.APIBase)
+			attemptSpan.SetAttr("request_id", requestID)
+
+			reqCtx, cancelReq := withRequestTimeout(attemptCtx, target.transport, upstreamStreams(payload, target.params, upstreamPath))
+			upReq, err := s.newUpstreamRequest(reqCtx, r, payload, target, upstreamPath)
+			var client *http.Client
+			if err == nil {
+				client, err = s.clients.client(target.transport)
+				if err != nil {
+					err = fmt.Errorf("%w: %v", errUpstreamTransport, err)
+				}
+			}
+			if err != nil {
+				cancelReq()
+				attemptSpan.SetError(err.Error())
+				attemptSpan.End()
+				if r.Context().Err() != nil {
+					s.breakers.record(cfg.CircuitBreaker, key, outcomeIgnored)
+					s.logger.Info("request cancelled before upstream attempt", "request_id", requestID)
+					return nil, target
+				}
+				outcome := outcomeIgnored
+				if errors.Is(err, adapter.ErrUpstreamAuth) || errors.Is(err, errUpstreamTransport) {
+					outcome = outcomeFailure
+				}
+				s.breakers.record(cfg.CircuitBreaker, key, outcome)
+				s.logger.Warn(
+					"upstream deployment cannot serve request, trying next",
+					"error", err,
+					"model_name", target.modelName,
+					"upstream_model", target.params.Model,
+					"api_base", target.params.APIBase,
+					"request_id", requestID,
+				)
+				if unusableErr == nil {
+					unusable, unusableErr = target, err
+				}
+				break
+			}
+
+			resp, err := client.Do(upReq)
+			if err != nil {
+				cancelReq()
+			} else {
+				resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancelReq}
+			}
+			s.breakers.record(cfg.CircuitBreaker, key, circuitOutcomeFor(r.Context(), resp, err))
+			class := upstreamErrorClass(r.Context(), resp, err)
+			if class != "" {
+				s.metrics.observeUpstreamError(target, class)
+				attemptSpan.SetAttr("error.type", class)
+			}
+			if err != nil {
+				attemptSpan.SetError(redactError(err).Error())
+			} else {
+				attemptSpan.SetAttr("http.response.status_code", resp.StatusCode)
+				if resp.StatusCode >= http.StatusBadRequest {
+					attemptSpan.SetError(resp.Status)
+				}
+			}
+			attemptSpan.End()
+
+			var retryable bool
+			waitTooLong := false
+			wait := backoffDelay(policy, attempt)
+			if err != nil {
+				retryable = r.Context().Err() == nil && policy.RetriesError(classifyError(err))
+			} else {
+				retryable = policy.RetriesStatus(resp.StatusCode)
+				if after, ok := retryAfter(resp.Header); ok {
+					wait = after
+					waitTooLong = after > policy.MaxBackoff
+				}
+			}
+
+			if !retryable {
+				if err != nil {
+					s.handleUpstreamFailure(w, err, target.transport, requestID)
+					return nil, target
+				}
+				return resp, target
+			}
+
+			retrySame := attempt < policy.MaxAttempts && !waitTooLong
+			if !retrySame && lastTarget {
+				if err != nil {
+					s.handleUpstreamFailure(w, err, target.transport, requestID)
+					return nil, target
+				}
+				return resp, target
+			}
+
+			s.logAttemptFailure(target, requestID, attempt, policy.MaxAttempts, retrySame, wait, resp, err)
+			if !retrySame {
+				failed.keep(target, resp, err)
+				break
+			}
+			if resp != nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			if err := sleepContext(r.Context(), wait); err != nil {
+				s.logger.Info("request cancelled during retry backoff", "request_id", requestID)
+				return nil, target
+			}
+		}
+	}
+
+	if failed.target.modelName != "" {
+		if failed.err != nil {
+			s.handleUpstreamFailure(w, failed.err, failed.target.transport, requestID)
+			return nil, failed.target
+		}
+		resp := failed.resp
+		failed.resp = nil
+		return resp, failed.target
+	}
+	if limited != nil {
+		setRetryAfter(w.Header(), limited.retryAfter)
+		apierrors.Write(w, http.StatusTooManyRequests, "rate_limit_error", "rate limit exceeded for every deployment of model: "+route.ModelName, requestID)
+		return nil, upstreamTarget{}
+	}
+	if unusableErr != nil {
+		s.writeRequestBuildError(w, unusableErr, unusable, requestID)
+		return nil, unusable
+	}
+	apierrors.Write(w, http.StatusServiceUnavailable, "overloaded_error", "no healthy upstream deployment for model: "+route.ModelName, requestID)
+	return nil, upstreamTarget{}
+}
+
+func (s *Service) newUpstreamRequest(ctx context.Context, r *http.Request, payload map[string]any, target upstreamTarget, upstreamPath string) (*http.Request, error) {
+	ad := s.adapterFor(target.params)
+	payload["model"] = target.params.Model
+	body := payload
+	requested, _ := payload["stream"].(bool)
+	if stream := upstreamStreams(payload, target.params, upstreamPath); stream != requested {
+		body = maps.Clone(payload)
+		body["stream"] = stream
+	}
+	translated, err := ad.TranslateRequest(upstreamPath, body)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamURL, err := ad.BuildUpstreamURL(target.params.APIBase, translated.Path, mergeQuery(r.URL.RawQuery, translated.RawQuery))
+	if err != nil {
+		return nil, fmt.Errorf("build upstream URL: %w", err)
+	}
+
+	upReq, err := http.NewRequestWithContext(ctx, r.Method, upstreamURL, bytes.NewReader(translated.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	copyRequestHeaders(upReq.Header, r.Header)
+	tracing.Inject(ctx, upReq.Header)
+	ad.ApplyAuthHeaders(upReq.Header, target.params)
+	if upReq.Header.Get("Content-Type") == "" {
+		upReq.Header.Set("Content-Type", "application/json")
 	}
+	if authorizer, ok := ad.(adapter.RequestAuthorizer); ok {
+		if err := authorizer.AuthorizeRequest(upReq, target.params); err != nil {
+			return nil, fmt.Errorf("authorize upstream request: %w", err)
+		}
+	}
+	return upReq, nil
+}
 
-	w.WriteHeader(resp.StatusCode)
-	_, _ = w.Write(respBody)
+func (s *Service) adapterFor(params config.UpstreamParams) adapter.Adapter {
+	if ad, ok := s.adapters[params.Provider]; ok {
+		return ad
+	}
+	return s.adapter
 }
 
-func (s *Service) handleUpstreamFailure(w http.ResponseWriter, err error, requestID string) {
-	s.logger.Error("upstream request failed", "error", err, "request_id", requestID)
+func (s *Service) writeRequestBuildError(w http.ResponseWriter, err error, target upstreamTarget, requestID string) {
+	switch {
+	case errors.Is(err, adapter.ErrUnsupportedPath):
+		apierrors.Write(w, http.StatusNotFound, "not_found_error", "path is not supported by provider "+target.params.Provider, requestID)
+	case errors.Is(err, adapter.ErrInvalidRequest):
+		apierrors.Write(w, http.StatusBadRequest, "invalid_request_error", err.Error(), requestID)
+	case errors.Is(err, adapter.ErrUpstreamAuth):
+		s.logger.Error("failed to authorize upstream request", "error", err, "request_id", requestID)
+		apierrors.Write(w, http.StatusBadGateway, "api_error", "failed to authorize upstream request", requestID)
+	case errors.Is(err, errUpstreamTransport):
+		s.logger.Error("failed to configure upstream transport", "error", err, "request_id", requestID)
+		apierrors.Write(w, http.StatusBadGateway, "api_error", "failed to configure upstream transport", requestID)
+	default:
+		s.logger.Error("failed to build upstream request", "error", err, "request_id", requestID)
+		apierrors.Write(w, http.StatusInternalServerError, "api_error", "failed to build upstream request", requestID)
+	}
+}
 
-	if errors.Is(err, context.DeadlineExceeded) {
-		apierrors.Write(w, http.StatusGatewayTimeout, "api_error", "upstream timeout", requestID)
+func mergeQuery(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "&" + b
+	}
+}
+
+func (s *Service) logAttemptFailure(target upstreamTarget, requestID string, attempt, maxAttempts int, retrySame bool, wait time.Duration, resp *http.Response, err error) {
+	args := []any{
+		"attempt", attempt,
+		"max_attempts", maxAttempts,
+		"model_name", target.modelName,
+		"upstream_model", target.params.Model,
+		"api_base", target.params.APIBase,
+		"request_id", requestID,
+	}
+	if err != nil {
+		args = append(args, "error", redactError(err), "error_class", classifyError(err))
+	} else {
+		args = append(args, "status", resp.StatusCode)
+	}
+
+	if retrySame {
+		s.logger.Warn("upstream attempt failed, retrying", append(args, "backoff_ms", wait.Milliseconds())...)
 		return
 	}
+	s.logger.Warn("upstream attempt failed, failing over", args...)
+}
 
-	var netErr net.Error
-	if errors.As(err, &netErr) && netErr.Timeout() {
-		apierrors.Write(w, http.StatusGatewayTimeout, "api_error", "upstream timeout", requestID)
+func (s *Service) handleUpstreamFailure(w http.ResponseWriter, err error, settings config.Transport, requestID string) {
+	if classifyError(err) == errorClassTimeout {
+		kind := timeoutKind(err)
+		s.logger.Error("upstream request timed out", "error", redactError(err), "timeout", kind, "request_id", requestID)
+		apierrors.Write(w, http.StatusGatewayTimeout, "api_error", timeoutMessage(kind, settings), requestID)
 		return
 	}
 
+	s.logger.Error("upstream request failed", "error", redactError(err), "request_id", requestID)
+
 	apierrors.Write(w, http.StatusBadGateway, "api_error", "upstream request failed", requestID)
 }
 
-func (s *Service) streamResponse(w http.ResponseWriter, body io.Reader, requestID string) {
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		_, _ = io.Copy(w, body)
-		return
-	}
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	requestID := requestIDFromContext(r.Context())
 
-	buf := make([]byte, 4*1024)
-	for {
-		n, err := body.Read(buf)
-		if n > 0 {
-			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
-				s.logger.Error("failed to write stream chunk", "error", writeErr, "request_id", requestID)
-				return
-			}
-			flusher.Flush()
-		}
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return
-			}
-			if errors.Is(err, context.Canceled) {
-				return
-			}
-			s.logger.Error("failed to read stream chunk", "error", err, "request_id", requestID)
-			return
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			apierrors.Write(w, http.StatusRequestEntityTooLarge, "invalid_request_error", "request body too large", requestID)
+			return nil, false
 		}
+		apierrors.Write(w, http.StatusBadRequest, "invalid_request_error", "failed to read request body", requestID)
+		return nil, false
 	}
+	return body, true
 }
 
 func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allow string) {
@@ -233,7 +703,7 @@ func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allow string)
 
 func isEventStream(headers http.Header) bool {
 	contentType := strings.ToLower(headers.Get("Content-Type"))
-	return strings.Contains(contentType, "text/event-stream")
+	return strings.Contains(contentType, "text/event-stream") || strings.Contains(contentType, "application/vnd.amazon.eventstream")
 }
 
 func copyRequestHeaders(dst, src http.Header) {
@@ -241,7 +711,7 @@ func copyRequestHeaders(dst, src http.Header) {
 		if isHopByHopHeader(k) {
 			continue
 		}
-		if strings.EqualFold(k, "Authorization") || strings.EqualFold(k, "x-api-key") {
+		if strings.EqualFold(k, "Authorization") || strings.EqualFold(k, "x-api-key") || strings.EqualFold(k, cacheHeader) {
 			continue
 		}
 		for _, v := range values {
@@ -284,3 +754,12 @@ func requestIDFromContext(ctx context.Context) string {
 func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
 	return context.WithValue(ctx, contextKeyRequestID, requestID)
 }
+
+func ContextWithVirtualKey(ctx context.Context, key config.VirtualKey) context.Context {
+	return context.WithValue(ctx, contextKeyVirtualKey, key)
+}
+
+func VirtualKeyFromContext(ctx context.Context) (config.VirtualKey, bool) {
+	key, ok := ctx.Value(contextKeyVirtualKey).(config.VirtualKey)
+	return key, ok
+}
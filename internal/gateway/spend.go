@@ -0,0 +1,23 @@
+package gateway
+
+import (
+	"net/http"
+
+	apierrors "anthropic-gateway/internal/errors"
+)
+
+func (s *Service) HandleSpend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	body, err := s.spend.Snapshot()
+	if err != nil {
+		s.logger.Error("failed to encode spend response", "error", err, "request_id", requestIDFromContext(r.Context()))
+		apierrors.Write(w, http.StatusInternalServerError, "api_error", "failed to encode response", requestIDFromContext(r.Context()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
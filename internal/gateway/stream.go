@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
+)
+
+var (
+	errStreamIdle       = errors.New("upstream stream idle timeout")
+	errStreamIncomplete = errors.New("upstream stream ended unexpectedly")
+	errStreamAborted    = errors.New("stream closed for shutdown")
+)
+
+var pingFrame = sse.Encode(models.EventPing, []byte(`{"type": "ping"}`))
+
+type streamRead struct {
+	event sse.Event
+	err   error
+}
+
+func (s *Service) streamResponse(ctx context.Context, w http.ResponseWriter, body io.ReadCloser, policy config.Streaming, requestID string) error {
+	s.drain.streams.Add(1)
+	defer s.drain.streams.Add(-1)
+
+	flusher, _ := w.(http.Flusher)
+	write := func(frame []byte) error {
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	reads := make(chan streamRead)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reader := sse.NewReader(body)
+		for {
+			event, err := reader.Next()
+			select {
+			case reads <- streamRead{event: event, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		body.Close()
+		wg.Wait()
+	}()
+
+	idle := newStreamTimer(policy.IdleTimeout)
+	defer idle.Stop()
+	ping := newStreamTimer(policy.PingInterval)
+	defer ping.Stop()
+
+	terminated := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.drain.abort:
+			if !terminated {
+				_ = write(sse.Encode(models.EventError, apierrors.Marshal("overloaded_error", "gateway is shutting down, retry the request", requestID)))
+			}
+			return errStreamAborted
+		case <-idle.C():
+			s.logger.Warn("upstream stream idle, closing", "idle_timeout_ms", policy.IdleTimeout.Milliseconds(), "request_id", requestID)
+			_ = write(sse.Encode(models.EventError, apierrors.Marshal("overloaded_error", fmt.Sprintf("upstream stream idle for %s", policy.IdleTimeout), requestID)))
+			return errStreamIdle
+		case <-ping.C():
+			if err := write(pingFrame); err != nil {
+				s.logger.Error("failed to write stream event", "error", err, "request_id", requestID)
+				return err
+			}
+			ping.Reset()
+		case read := <-reads:
+			if read.err != nil {
+				switch {
+				case errors.Is(read.err, context.Canceled):
+					return read.err
+				case errors.Is(read.err, io.EOF):
+					if terminated {
+						return nil
+					}
+					s.logger.Warn("upstream stream ended without message_stop", "request_id", requestID)
+					_ = write(sse.Encode(models.EventError, apierrors.Marshal("api_error", errStreamIncomplete.Error(), requestID)))
+					return errStreamIncomplete
+				}
+				s.logger.Error("failed to read stream event", "error", read.err, "request_id", requestID)
+				_ = write(sse.Encode(models.EventError, apierrors.Marshal("api_error", "upstream stream failed", requestID)))
+				return read.err
+			}
+
+			idle.Reset()
+			if read.event.Name == models.EventMessageStop || read.event.Name == models.EventError {
+				terminated = true
+			}
+			if err := write(sse.Encode(read.event.Name, read.event.Data)); err != nil {
+				s.logger.Error("failed to write stream event", "error", err, "request_id", requestID)
+				return err
+			}
+			ping.Reset()
+		}
+	}
+}
+
+type streamTimer struct {
+	timer *time.Timer
+	d     time.Duration
+}
+
+func newStreamTimer(d time.Duration) *streamTimer {
+	if d <= 0 {
+		return &streamTimer{}
+	}
+	return &streamTimer{timer: time.NewTimer(d), d: d}
+}
+
+func (t *streamTimer) C() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+func (t *streamTimer) Reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.d)
+	}
+}
+
+func (t *streamTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
@@ -0,0 +1,216 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+)
+
+const (
+	timeoutConnect        = "connect"
+	timeoutTLSHandshake   = "tls_handshake"
+	timeoutResponseHeader = "response_header"
+	timeoutRequest        = "request"
+)
+
+var errUpstreamTransport = errors.New("upstream transport is misconfigured")
+
+var errRequestTimeout error = requestTimeoutError{}
+
+type requestTimeoutError struct{}
+
+func (requestTimeoutError) Error() string        { return "upstream request timeout" }
+func (requestTimeoutError) Timeout() bool        { return true }
+func (requestTimeoutError) Temporary() bool      { return true }
+func (requestTimeoutError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+type transportPool struct {
+	mu         sync.Mutex
+	transports map[config.Transport]*http.Transport
+}
+
+func newTransportPool(transports map[config.Transport]*http.Transport) *transportPool {
+	return &transportPool{transports: transports}
+}
+
+func transportKey(settings config.Transport) config.Transport {
+	settings.RequestTimeout = 0
+	return settings
+}
+
+func buildTransports(cfg *config.Config) (map[config.Transport]*http.Transport, error) {
+	transports := make(map[config.Transport]*http.Transport, len(cfg.ModelList))
+	for _, route := range cfg.ModelList {
+		key := transportKey(cfg.TransportFor(route))
+		if _, ok := transports[key]; ok {
+			continue
+		}
+		transport, err := newTransport(key)
+		if err != nil {
+			return nil, fmt.Errorf("model %s transport: %w", route.ModelName, err)
+		}
+		transports[key] = transport
+	}
+	return transports, nil
+}
+
+func (p *transportPool) client(settings config.Transport) (*http.Client, error) {
+	key := transportKey(settings)
+
+	p.mu.Lock()
+	transport, ok := p.transports[key]
+	p.mu.Unlock()
+	if !ok {
+		var err error
+		transport, err = newTransport(key)
+		if err != nil {
+			return nil, err
+		}
+		transport.DisableKeepAlives = true
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+func (p *transportPool) replace(transports map[config.Transport]*http.Transport) {
+	p.mu.Lock()
+	prev := p.transports
+	p.transports = transports
+	p.mu.Unlock()
+
+	for _, transport := range prev {
+		transport.CloseIdleConnections()
+	}
+}
+
+func (p *transportPool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, transport := range p.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+func withRequestTimeout(ctx context.Context, settings config.Transport, stream bool) (context.Context, context.CancelFunc) {
+	if stream || settings.RequestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, settings.RequestTimeout, errRequestTimeout)
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func newTransport(settings config.Transport) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: settings.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = settings.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = settings.ResponseHeaderTimeout
+	transport.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = settings.MaxConnsPerHost
+	transport.IdleConnTimeout = settings.IdleConnTimeout
+
+	if settings.Proxy != "" {
+		proxyURL, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+func newTLSConfig(settings config.Transport) (*tls.Config, error) {
+	if settings.CAFile == "" && settings.CertFile == "" && settings.ServerName == "" && !settings.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	if settings.CAFile != "" {
+		data, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("ca_file %s contains no PEM certificates", settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if settings.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func timeoutKind(err error) string {
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, errRequestTimeout):
+		return timeoutRequest
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return timeoutConnect
+	case hasErrorText(err, "net/http: TLS handshake timeout"):
+		return timeoutTLSHandshake
+	case hasErrorText(err, "net/http: timeout awaiting response headers"):
+		return timeoutResponseHeader
+	}
+	return ""
+}
+
+func hasErrorText(err error, text string) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if err.Error() == text {
+			return true
+		}
+	}
+	return false
+}
+
+func timeoutMessage(kind string, settings config.Transport) string {
+	switch kind {
+	case timeoutConnect:
+		return fmt.Sprintf("upstream connect timeout (connect_timeout %s)", settings.ConnectTimeout)
+	case timeoutTLSHandshake:
+		return fmt.Sprintf("upstream TLS handshake timeout (tls_handshake_timeout %s)", settings.TLSHandshakeTimeout)
+	case timeoutResponseHeader:
+		return fmt.Sprintf("upstream response header timeout (response_header_timeout %s)", settings.ResponseHeaderTimeout)
+	case timeoutRequest:
+		return fmt.Sprintf("upstream request timeout (request_timeout %s)", settings.RequestTimeout)
+	}
+	return "upstream timeout"
+}
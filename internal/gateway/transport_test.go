@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"anthropic-gateway/internal/config"
+)
+
+func TestTransportPoolIsRebuiltOnReload(t *testing.T) {
+	route := func(name string, transport *config.Transport) config.ModelRoute {
+		return config.ModelRoute{
+			ModelName: name,
+			Params:    config.UpstreamParams{Model: name, APIBase: "https://api.example.com"},
+			Transport: transport,
+		}
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCA(t, caFile, "first")
+	tlsRoute := route("sonnet", &config.Transport{CAFile: caFile})
+	before := &config.Config{ModelList: []config.ModelRoute{tlsRoute, route("haiku", &config.Transport{MaxConnsPerHost: 4})}}
+	after := &config.Config{ModelList: []config.ModelRoute{tlsRoute}}
+
+	transports, err := buildTransports(before)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	p := newTransportPool(transports)
+	old := p.transports[transportKey(before.TransportFor(tlsRoute))]
+
+	writeTestCA(t, caFile, "second")
+	transports, err = buildTransports(after)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	p.replace(transports)
+	if len(p.transports) != 1 {
+		t.Fatalf("transports after reload = %d, want 1", len(p.transports))
+	}
+	rebuilt := p.transports[transportKey(after.TransportFor(tlsRoute))]
+	if rebuilt == old || rebuilt.TLSClientConfig.RootCAs.Equal(old.TLSClientConfig.RootCAs) {
+		t.Fatalf("rotated ca_file was not re-read on reload")
+	}
+
+	client, err := p.client(before.TransportFor(before.ModelList[1]))
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	if !client.Transport.(*http.Transport).DisableKeepAlives || len(p.transports) != 1 {
+		t.Fatalf("transport of a replaced config was pooled")
+	}
+}
+
+func writeTestCA(t *testing.T, path, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+}
+
+type testTimeoutError struct{ text string }
+
+func (e testTimeoutError) Error() string { return e.text }
+func (testTimeoutError) Timeout() bool   { return true }
+func (testTimeoutError) Temporary() bool { return true }
+
+func TestTimeoutKind(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"request", &url.Error{Op: "Post", URL: "https://api.example.com", Err: errRequestTimeout}, timeoutRequest},
+		{"connect", &url.Error{Op: "Post", URL: "https://api.example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: testTimeoutError{"i/o timeout"}}}, timeoutConnect},
+		{"response header", &url.Error{Op: "Post", URL: "https://api.example.com", Err: testTimeoutError{"net/http: timeout awaiting response headers"}}, timeoutResponseHeader},
+		{"tls handshake", &url.Error{Op: "Post", URL: "https://api.example.com", Err: testTimeoutError{"net/http: TLS handshake timeout"}}, timeoutTLSHandshake},
+		{"tls handshake through proxy", &url.Error{Op: "Post", URL: "https://api.example.com", Err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: testTimeoutError{"net/http: TLS handshake timeout"}}}, timeoutTLSHandshake},
+		{"client deadline", &url.Error{Op: "Post", URL: "https://api.example.com", Err: context.DeadlineExceeded}, ""},
+		{"other timeout", &url.Error{Op: "Post", URL: "https://api.example.com", Err: testTimeoutError{"i/o timeout"}}, ""},
+		{"not a timeout", &url.Error{Op: "Post", URL: "https://api.example.com", Err: errors.New("connection refused")}, ""},
+	} {
+		if got := timeoutKind(tc.err); got != tc.want {
+			t.Errorf("%s: timeoutKind = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
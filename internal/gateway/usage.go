@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/tracing"
+)
+
+type usageEnvelope struct {
+	Usage   *models.Usage `json:"usage"`
+	Message *struct {
+		Usage *models.Usage `json:"usage"`
+	} `json:"message"`
+}
+
+func usageFromMessage(body []byte) (models.Usage, bool) {
+	var envelope usageEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Usage == nil {
+		return models.Usage{}, false
+	}
+	return *envelope.Usage, true
+}
+
+type streamUsageRecorder struct {
+	line  []byte
+	usage models.Usage
+	seen  bool
+}
+
+func (u *streamUsageRecorder) Write(p []byte) (int, error) {
+	data := p
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			u.line = append(u.line, data...)
+			break
+		}
+		u.line = append(u.line, data[:i]...)
+		u.processLine(u.line)
+		u.line = u.line[:0]
+		data = data[i+1:]
+	}
+	return len(p), nil
+}
+
+func (u *streamUsageRecorder) processLine(line []byte) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if !bytes.HasPrefix(line, []byte("data:")) || !bytes.Contains(line, []byte(`"usage"`)) {
+		return
+	}
+	var envelope usageEnvelope
+	if err := json.Unmarshal(bytes.TrimSpace(line[len("data:"):]), &envelope); err != nil {
+		return
+	}
+	if envelope.Message != nil && envelope.Message.Usage != nil {
+		u.merge(*envelope.Message.Usage)
+	}
+	if envelope.Usage != nil {
+		u.merge(*envelope.Usage)
+	}
+}
+
+func (u *streamUsageRecorder) merge(usage models.Usage) {
+	u.seen = true
+	u.usage.InputTokens = max(u.usage.InputTokens, usage.InputTokens)
+	u.usage.OutputTokens = max(u.usage.OutputTokens, usage.OutputTokens)
+	u.usage.CacheCreationInputTokens = max(u.usage.CacheCreationInputTokens, usage.CacheCreationInputTokens)
+	u.usage.CacheReadInputTokens = max(u.usage.CacheReadInputTokens, usage.CacheReadInputTokens)
+}
+
+func (u *streamUsageRecorder) Usage() (models.Usage, bool) {
+	return u.usage, u.seen
+}
+
+func setUsageAttrs(span *tracing.Span, usage models.Usage) {
+	span.SetAttr("gen_ai.usage.input_tokens", usage.InputTokens)
+	span.SetAttr("gen_ai.usage.output_tokens", usage.OutputTokens)
+	if usage.CacheReadInputTokens > 0 {
+		span.SetAttr("gen_ai.usage.cache_read_input_tokens", usage.CacheReadInputTokens)
+	}
+	if usage.CacheCreationInputTokens > 0 {
+		span.SetAttr("gen_ai.usage.cache_creation_input_tokens", usage.CacheCreationInputTokens)
+	}
+}
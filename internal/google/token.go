@@ -0,0 +1,222 @@
+package google
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	defaultTokenURI = "https://oauth2.googleapis.com/token"
+	jwtBearerGrant  = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	assertionTTL    = time.Hour
+	refreshMargin   = 5 * time.Minute
+)
+
+type ServiceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type TokenSource struct {
+	key       ServiceAccountKey
+	signer    *rsa.PrivateKey
+	scope     string
+	client    *http.Client
+	now       func() time.Time
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	refresh   *tokenFetch
+}
+
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func NewTokenSource(keyJSON []byte, scope string, client *http.Client) (*TokenSource, error) {
+	var key ServiceAccountKey
+	if err := json.Unmarshal(keyJSON, &key); err != nil {
+		return nil, fmt.Errorf("decode service account key: %w", err)
+	}
+	if key.Type != "" && key.Type != "service_account" {
+		return nil, fmt.Errorf("unsupported credentials type %q", key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, errors.New("service account key requires client_email and private_key")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = defaultTokenURI
+	}
+
+	signer, err := parsePrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &TokenSource{key: key, signer: signer, scope: scope, client: client, now: time.Now}, nil
+}
+
+func (ts *TokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	if ts.token != "" && ts.now().Before(ts.expiresAt.Add(-refreshMargin)) {
+		token := ts.token
+		ts.mu.Unlock()
+		return token, nil
+	}
+	f := ts.refresh
+	if f == nil {
+		f = &tokenFetch{done: make(chan struct{})}
+		ts.refresh = f
+		go ts.refreshToken(context.WithoutCancel(ctx), f)
+	}
+	ts.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (ts *TokenSource) refreshToken(ctx context.Context, f *tokenFetch) {
+	token, expiresIn, err := ts.fetch(ctx)
+
+	ts.mu.Lock()
+	if err == nil {
+		ts.token = token
+		ts.expiresAt = ts.now().Add(expiresIn)
+	}
+	ts.refresh = nil
+	ts.mu.Unlock()
+
+	f.token, f.err = token, err
+	close(f.done)
+}
+
+func (ts *TokenSource) fetch(ctx context.Context) (string, time.Duration, error) {
+	assertion, err := ts.assertion()
+	if err != nil {
+		return "", 0, err
+	}
+
+	form := url.Values{"grant_type": {jwtBearerGrant}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("request access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", 0, fmt.Errorf("decode token response: %w", err)
+	}
+	if out.AccessToken == "" {
+		return "", 0, errors.New("token response has no access_token")
+	}
+	expiresIn := time.Duration(out.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = assertionTTL
+	}
+	return out.AccessToken, expiresIn, nil
+}
+
+func (ts *TokenSource) assertion() (string, error) {
+	now := ts.now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if ts.key.PrivateKeyID != "" {
+		header["kid"] = ts.key.PrivateKeyID
+	}
+	claims := map[string]any{
+		"iss":   ts.key.ClientEmail,
+		"scope": ts.scope,
+		"aud":   ts.key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionTTL).Unix(),
+	}
+
+	encodedHeader, err := encodeSegment(header)
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodedHeader + "." + encodedClaims
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, ts.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func encodeSegment(v any) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encode assertion: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func parsePrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("service account private_key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("service account private_key is not an RSA key")
+		}
+		return rsaKey, nil
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse service account private_key: %w", err)
+	}
+	return key, nil
+}
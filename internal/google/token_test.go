@@ -0,0 +1,181 @@
+package google_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"anthropic-gateway/internal/google"
+)
+
+func TestTokenSourceMintsAndCachesToken(t *testing.T) {
+	keyJSON, tokenURL, calls := newFakeTokenEndpoint(t, 3600)
+
+	ts, err := google.NewTokenSource(keyJSON(tokenURL), google.CloudPlatformScope, nil)
+	if err != nil {
+		t.Fatalf("new token source: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		token, err := ts.Token(context.Background())
+		if err != nil {
+			t.Fatalf("token: %v", err)
+		}
+		if token != "token-1" {
+			t.Fatalf("token = %q", token)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("token endpoint calls = %d, want 1", got)
+	}
+}
+
+func TestTokenSourceRefreshesBeforeExpiry(t *testing.T) {
+	keyJSON, tokenURL, calls := newFakeTokenEndpoint(t, 60)
+
+	ts, err := google.NewTokenSource(keyJSON(tokenURL), google.CloudPlatformScope, nil)
+	if err != nil {
+		t.Fatalf("new token source: %v", err)
+	}
+	first, _ := ts.Token(context.Background())
+	second, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if first == second || calls.Load() != 2 {
+		t.Fatalf("expected refresh, got %q then %q after %d calls", first, second, calls.Load())
+	}
+}
+
+func TestTokenSourceSharesFetchAcrossCallers(t *testing.T) {
+	keyJSON, _, _ := newFakeTokenEndpoint(t, 3600)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"shared","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	ts, err := google.NewTokenSource(keyJSON(server.URL+"/token"), google.CloudPlatformScope, nil)
+	if err != nil {
+		t.Fatalf("new token source: %v", err)
+	}
+
+	results := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			token, err := ts.Token(context.Background())
+			if err != nil {
+				t.Errorf("token: %v", err)
+			}
+			results <- token
+		}()
+	}
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ts.Token(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller err = %v", err)
+	}
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		if token := <-results; token != "shared" {
+			t.Fatalf("token = %q", token)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("token endpoint calls = %d, want 1", got)
+	}
+}
+
+func TestNewTokenSourceRejectsInvalidKey(t *testing.T) {
+	_, err := google.NewTokenSource([]byte(`{"type":"service_account","client_email":"a@b","private_key":"nope"}`), google.CloudPlatformScope, nil)
+	if err == nil || !strings.Contains(err.Error(), "PEM") {
+		t.Fatalf("expected PEM error, got %v", err)
+	}
+}
+
+func newFakeTokenEndpoint(t *testing.T, expiresIn int) (func(string) []byte, string, *atomic.Int32) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %q", r.Form.Get("grant_type"))
+		}
+		verifyAssertion(t, &key.PublicKey, r.Form.Get("assertion"), "http://"+r.Host+r.URL.Path)
+
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":%d,"token_type":"Bearer"}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+
+	keyJSON := func(tokenURI string) []byte {
+		encoded, _ := json.Marshal(map[string]string{
+			"type":           "service_account",
+			"client_email":   "gateway@project.iam.gserviceaccount.com",
+			"private_key_id": "kid-1",
+			"private_key":    pemKey,
+			"token_uri":      tokenURI,
+		})
+		return encoded
+	}
+	return keyJSON, server.URL + "/token", &calls
+}
+
+func verifyAssertion(t *testing.T, pub *rsa.PublicKey, assertion, audience string) {
+	t.Helper()
+
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Errorf("assertion has %d parts", len(parts))
+		return
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("assertion signature: %v", err)
+	}
+
+	rawClaims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]any
+	_ = json.Unmarshal(rawClaims, &claims)
+	if claims["iss"] != "gateway@project.iam.gserviceaccount.com" || claims["aud"] != audience || claims["scope"] != google.CloudPlatformScope {
+		t.Errorf("claims = %v", claims)
+	}
+}
@@ -0,0 +1,80 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"anthropic-gateway/internal/adapter"
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/gateway"
+)
+
+func withVirtualKeys(next http.Handler, service *gateway.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := service.Config()
+		if strings.HasPrefix(r.URL.Path, "/admin/") {
+			if cfg.AdminKey() == "" {
+				writeAuthError(w, r, http.StatusUnauthorized, "authentication_error", "admin endpoints require admin.key to be configured")
+				return
+			}
+			token := inboundAPIKey(r)
+			if token == "" {
+				writeAuthError(w, r, http.StatusUnauthorized, "authentication_error", "missing API key")
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminKey())) != 1 {
+				writeAuthError(w, r, http.StatusUnauthorized, "authentication_error", "invalid admin key")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !cfg.KeysEnabled() || !requiresVirtualKey(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := inboundAPIKey(r)
+		if token == "" {
+			writeAuthError(w, r, http.StatusUnauthorized, "authentication_error", "missing API key")
+			return
+		}
+		key, ok := cfg.LookupKey(token)
+		if !ok {
+			writeAuthError(w, r, http.StatusUnauthorized, "authentication_error", "invalid API key")
+			return
+		}
+		if !key.IsEnabled() {
+			writeAuthError(w, r, http.StatusUnauthorized, "authentication_error", "API key is disabled")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(gateway.ContextWithVirtualKey(r.Context(), key)))
+	})
+}
+
+func requiresVirtualKey(path string) bool {
+	return strings.HasPrefix(path, "/anthropic") || strings.HasPrefix(path, "/openai")
+}
+
+func inboundAPIKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("x-api-key")); key != "" {
+		return key
+	}
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+	return ""
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, statusCode int, errorType, message string) {
+	if strings.HasPrefix(r.URL.Path, "/openai") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		_, _ = w.Write(adapter.MarshalOpenAIError(errorType, message))
+		return
+	}
+	apierrors.Write(w, statusCode, errorType, message, w.Header().Get("x-request-id"))
+}
@@ -0,0 +1,26 @@
+package httpserver
+
+import (
+	"net/http"
+
+	apierrors "anthropic-gateway/internal/errors"
+	"anthropic-gateway/internal/gateway"
+)
+
+func withDrain(next http.Handler, service *gateway.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		release, ok := service.Admit()
+		if !ok {
+			w.Header().Set("Connection", "close")
+			apierrors.Write(w, http.StatusServiceUnavailable, "overloaded_error", "gateway is shutting down", w.Header().Get("x-request-id"))
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
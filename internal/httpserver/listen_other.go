@@ -0,0 +1,12 @@
+//go:build !unix
+
+package httpserver
+
+import (
+	"net"
+	"os"
+)
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package httpserver
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	old := syscall.Umask(int(0o777 &^ mode.Perm()))
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
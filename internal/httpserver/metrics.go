@@ -0,0 +1,55 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"anthropic-gateway/internal/gateway"
+)
+
+func withMetrics(next http.Handler, mux *http.ServeMux, m *gateway.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, done := m.StartRequest(r.Context())
+		defer done()
+
+		rw := &metricsRecorder{ResponseWriter: w, statusCode: http.StatusOK, start: time.Now()}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		var firstByte time.Duration
+		if !rw.firstByte.IsZero() && strings.HasPrefix(rw.Header().Get("Content-Type"), "text/event-stream") {
+			firstByte = rw.firstByte.Sub(rw.start)
+		}
+		m.ObserveRequest(ctx, route, rw.statusCode, time.Since(rw.start), firstByte)
+	})
+}
+
+type metricsRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	start      time.Time
+	firstByte  time.Time
+}
+
+func (r *metricsRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *metricsRecorder) Write(p []byte) (int, error) {
+	if r.firstByte.IsZero() && len(p) > 0 {
+		r.firstByte = time.Now()
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *metricsRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
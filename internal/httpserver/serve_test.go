@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+func TestServeClosesOtherListenersWhenOneFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	broken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &Server{
+		httpServer: &http.Server{Handler: http.NotFoundHandler()},
+		listeners:  []net.Listener{ln, failingListener{broken}},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Serve() }()
+	select {
+	case err := <-errCh:
+		if err == nil || err.Error() != "accept failed" {
+			t.Fatalf("serve err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("serve did not return after a listener failed")
+	}
+	if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		conn.Close()
+		t.Fatalf("healthy listener is still accepting after serve returned")
+	}
+}
+
+func TestUnixSocketIsCreatedWithSocketMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket permissions are not enforced on windows")
+	}
+	socket := filepath.Join(t.TempDir(), "gateway.sock")
+	ln, err := listenUnix(socket, 0o600)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0o600 {
+		t.Fatalf("socket mode before chmod = %o, want 600", got)
+	}
+}
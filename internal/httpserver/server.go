@@ -2,15 +2,18 @@ package httpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"anthropic-gateway/internal/config"
 	"anthropic-gateway/internal/gateway"
 )
 
@@ -18,47 +21,112 @@ var requestSeq uint64
 
 type Server struct {
 	httpServer *http.Server
+	listen     config.Listeners
+	listeners  []net.Listener
+	logger     *slog.Logger
 }
 
-func New(addr string, logger *slog.Logger, service *gateway.Service) *Server {
+func New(listen config.Listeners, logger *slog.Logger, service *gateway.Service) *Server {
 	handler := NewHandler(logger, service)
 	return &Server{
-		httpServer: &http.Server{
-			Addr:    addr,
-			Handler: handler,
-		},
+		httpServer: &http.Server{Handler: handler},
+		listen:     listen,
+		logger:     logger,
 	}
 }
 
 func NewHandler(logger *slog.Logger, service *gateway.Service) http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/healthz", healthzHandler(service))
+	mux.Handle("/metrics", service.Metrics())
+	mux.HandleFunc("/admin/circuits", service.HandleCircuits)
+	mux.HandleFunc("/admin/spend", service.HandleSpend)
 	mux.HandleFunc("/anthropic/v1/messages", service.HandleMessages)
 	mux.HandleFunc("/anthropic/v1/messages/count_tokens", service.HandleCountTokens)
 	mux.HandleFunc("/anthropic/v1/models", service.HandleModels)
 	mux.HandleFunc("/anthropic", service.HandleUnsupported)
 	mux.HandleFunc("/anthropic/", service.HandleUnsupported)
-
-	handler := withRequestID(withLogging(mux, logger))
+	mux.HandleFunc("/openai/v1/chat/completions", service.HandleOpenAIChatCompletions)
+	mux.HandleFunc("/openai/v1/models", service.HandleOpenAIModels)
+	mux.HandleFunc("/openai", service.HandleOpenAIUnsupported)
+	mux.HandleFunc("/openai/", service.HandleOpenAIUnsupported)
+
+	handler := withVirtualKeys(mux, service)
+	handler = withMetrics(handler, mux, service.Metrics())
+	handler = withTracing(handler, mux, service.Tracer())
+	handler = withRequestID(withLogging(withDrain(handler, service), logger))
 	return handler
 }
 
 func (s *Server) ListenAndServe() error {
-	return s.httpServer.ListenAndServe()
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+func (s *Server) Listen() error {
+	for _, l := range s.listen {
+		ln, err := s.open(l)
+		if err != nil {
+			for _, opened := range s.listeners {
+				opened.Close()
+			}
+			s.listeners = nil
+			return fmt.Errorf("listen on %s: %w", l.Address, err)
+		}
+		s.listeners = append(s.listeners, ln)
+	}
+	return nil
+}
+
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, ln := range s.listeners {
+		addrs[i] = ln.Addr()
+	}
+	return addrs
+}
+
+func (s *Server) Serve() error {
+	errCh := make(chan error, len(s.listeners))
+	for _, ln := range s.listeners {
+		go func() {
+			errCh <- s.httpServer.Serve(ln)
+		}()
+	}
+	for range s.listeners {
+		if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+			s.httpServer.Close()
+			return err
+		}
+	}
+	return http.ErrServerClosed
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	return s.httpServer.Shutdown(ctx)
 }
 
-func healthzHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
+func (s *Server) Close() error {
+	return s.httpServer.Close()
+}
+
+func healthzHandler(service *gateway.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if service.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"status":"draining"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"status":"ok"}`))
 }
 
 func withRequestID(next http.Handler) http.Handler {
@@ -3,19 +3,37 @@ package httpserver_test
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"io"
+	"log"
 	"log/slog"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"anthropic-gateway/internal/adapter"
+	"anthropic-gateway/internal/aws"
 	"anthropic-gateway/internal/config"
 	"anthropic-gateway/internal/gateway"
 	"anthropic-gateway/internal/httpserver"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/sse"
 )
 
 func TestMessagesNonStreamingSuccess(t *testing.T) {
@@ -271,11 +289,2356 @@ func TestUpstreamPlainTextErrorIsNormalized(t *testing.T) {
 	}
 }
 
+func TestMessagesWeightedDeployments(t *testing.T) {
+	var hitsA, hitsB atomic.Int32
+	upstreamA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitsA.Add(1)
+		_, _ = w.Write([]byte(`{"id":"msg_a","type":"message"}`))
+	}))
+	defer upstreamA.Close()
+	upstreamB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hitsB.Add(1)
+		_, _ = w.Write([]byte(`{"id":"msg_b","type":"message"}`))
+	}))
+	defer upstreamB.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Deployments: []config.UpstreamParams{
+					{Model: "glm-4.7", APIBase: upstreamA.URL, APIKey: "a", AuthType: config.AuthTypeXAPIKey, Weight: 2},
+					{Model: "glm-4.7", APIBase: upstreamB.URL, APIKey: "b", AuthType: config.AuthTypeXAPIKey, Weight: 1},
+				},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	for i := 0; i < 6; i++ {
+		resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet"}`))
+		if err != nil {
+			t.Fatalf("do request: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	if hitsA.Load() != 4 || hitsB.Load() != 2 {
+		t.Fatalf("hits = %d/%d, want 4/2", hitsA.Load(), hitsB.Load())
+	}
+}
+
+func TestMessagesFailoverToNextDeployment(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`, 529)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer healthy.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Deployments: []config.UpstreamParams{
+					{Model: "glm-4.7", APIBase: failing.URL, APIKey: "a", AuthType: config.AuthTypeXAPIKey, Weight: 10},
+					{Model: "glm-4.7", APIBase: healthy.URL, APIKey: "b", AuthType: config.AuthTypeXAPIKey, Weight: 1},
+				},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "message_stop") {
+		t.Fatalf("unexpected stream body: %s", string(body))
+	}
+}
+
+func TestMessagesFallbackModelName(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+
+	var fallbackModel atomic.Value
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		fallbackModel.Store(payload["model"])
+		_, _ = w.Write([]byte(`{"id":"msg_fallback","type":"message"}`))
+	}))
+	defer fallback.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-5", APIBase: failing.URL, APIKey: "a", AuthType: config.AuthTypeXAPIKey},
+				Fallbacks: []string{"haiku"},
+			},
+			{
+				ModelName: "haiku",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: fallback.URL, APIKey: "b", AuthType: config.AuthTypeXAPIKey},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet"}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "msg_fallback") {
+		t.Fatalf("unexpected body: %s", string(body))
+	}
+	if got := fallbackModel.Load(); got != "glm-4.7" {
+		t.Fatalf("fallback upstream model = %v, want glm-4.7", got)
+	}
+}
+
+func TestMessagesConnectionErrorFailsOver(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL := dead.URL
+	dead.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"msg_ok","type":"message"}`))
+	}))
+	defer healthy.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Deployments: []config.UpstreamParams{
+					{Model: "glm-4.7", APIBase: deadURL, APIKey: "a", AuthType: config.AuthTypeXAPIKey, Weight: 10},
+					{Model: "glm-4.7", APIBase: healthy.URL, APIKey: "b", AuthType: config.AuthTypeXAPIKey, Weight: 1},
+				},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet"}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+}
+
+func TestMessagesRetriesWithRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.Header().Set("retry-after-ms", "100")
+			http.Error(w, "overloaded", 529)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_retry","type":"message"}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Retry: &config.RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Second},
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "a", AuthType: config.AuthTypeXAPIKey},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	start := time.Now()
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet"}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Fatalf("attempts = %d, want 3", got)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("retry-after-ms was not honored, elapsed=%v", elapsed)
+	}
+}
+
+func TestMessagesRouteRetryPolicyLimitsAttempts(t *testing.T) {
+	var attempts atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Retry: &config.RetryPolicy{MaxAttempts: 5, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "a", AuthType: config.AuthTypeXAPIKey},
+				Retry:     &config.RetryPolicy{MaxAttempts: 2, RetryOnStatus: []int{http.StatusServiceUnavailable}},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet"}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Fatalf("attempts = %d, want 2", got)
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	var healthy atomic.Bool
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message"}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		CircuitBreaker: &config.CircuitBreaker{FailureThreshold: 2, Window: time.Minute, Cooldown: 200 * time.Millisecond},
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "a", AuthType: config.AuthTypeXAPIKey},
+			},
+		},
+		Admin: &config.Admin{Key: "sk-admin"},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	post := func() int {
+		resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet"}`))
+		if err != nil {
+			t.Fatalf("do request: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	post()
+	post()
+	if got := post(); got != http.StatusServiceUnavailable {
+		t.Fatalf("status with open circuit = %d, want 503", got)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("upstream hits = %d, want 2", got)
+	}
+
+	body, _ := io.ReadAll(getWithKey(t, gw.URL+"/admin/circuits", "sk-admin").Body)
+	if !strings.Contains(string(body), `"state":"open"`) {
+		t.Fatalf("expected open circuit, got %s", string(body))
+	}
+
+	healthy.Store(true)
+	time.Sleep(250 * time.Millisecond)
+	if got := post(); got != http.StatusOK {
+		t.Fatalf("half-open probe status = %d, want 200", got)
+	}
+
+	body, _ = io.ReadAll(getWithKey(t, gw.URL+"/admin/circuits", "sk-admin").Body)
+	if !strings.Contains(string(body), `"state":"closed"`) {
+		t.Fatalf("expected closed circuit, got %s", string(body))
+	}
+}
+
+func TestMessagesOpenAIProvider(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer local-key" {
+			t.Fatalf("authorization = %q", got)
+		}
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload["model"] != "qwen3" {
+			t.Fatalf("model = %v", payload["model"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","model":"qwen3","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"length"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "qwen3", APIBase: upstream.URL, APIKey: "local-key", AuthType: config.AuthTypeBearer, Provider: config.ProviderOpenAI},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"type":"message"`) || !strings.Contains(string(body), `"stop_reason":"max_tokens"`) {
+		t.Fatalf("unexpected body: %s", string(body))
+	}
+}
+
+func TestMessagesOpenAIProviderStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload["stream"] != true {
+			t.Fatalf("stream flag not forwarded: %v", payload)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"c1\",\"model\":\"qwen3\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		_, _ = w.Write([]byte("data: {\"id\":\"c1\",\"model\":\"qwen3\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "qwen3", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer, Provider: config.ProviderOpenAI},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+	for _, want := range []string{"event: message_start", "event: content_block_delta", `"text":"hi"`, `"stop_reason":"end_turn"`, "event: message_stop"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("stream missing %q: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "chat.completion.chunk") || strings.Contains(out, "[DONE]") {
+		t.Fatalf("raw OpenAI frames leaked: %s", out)
+	}
+}
+
+func TestMessagesGeminiProviderStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-2.5-pro:streamGenerateContent" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.URL.Query(); got.Has("key") || got.Get("alt") != "sse" {
+			t.Fatalf("query = %q", r.URL.RawQuery)
+		}
+		if got := r.Header.Get("x-goog-api-key"); got != "gemini-key" {
+			t.Fatalf("x-goog-api-key = %q", got)
+		}
+		if r.Header.Get("x-api-key") != "" || r.Header.Get("anthropic-version") != "" {
+			t.Fatalf("anthropic headers leaked: %v", r.Header)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"hi\"}]},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":3,\"candidatesTokenCount\":1}}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "gemini-2.5-pro", APIBase: upstream.URL, APIKey: "gemini-key", AuthType: config.AuthTypeXAPIKey, Provider: config.ProviderGemini},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, gw.URL+"/anthropic/v1/messages", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("x-api-key", "client-key")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+	for _, want := range []string{"event: message_start", `"text":"hi"`, `"stop_reason":"end_turn"`, "event: message_stop"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("stream missing %q: %s", want, out)
+		}
+	}
+}
+
+func TestMessagesBedrockProviderStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/model/anthropic.claude-v2%3A1/invoke-with-response-stream" {
+			t.Fatalf("unexpected path: %s", r.URL.EscapedPath())
+		}
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Fatalf("authorization = %q", auth)
+		}
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload["anthropic_version"] != "bedrock-2023-05-31" || payload["model"] != nil {
+			t.Fatalf("unexpected body: %v", payload)
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		for _, event := range []string{
+			`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[],"usage":{"input_tokens":3,"output_tokens":0}}}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1}}`,
+			`{"type":"message_stop"}`,
+		} {
+			chunk, _ := json.Marshal(map[string][]byte{"bytes": []byte(event)})
+			_, _ = w.Write(aws.EncodeMessage(map[string]string{":message-type": "event", ":event-type": "chunk"}, chunk))
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params: config.UpstreamParams{
+					Model:              "anthropic.claude-v2:1",
+					APIBase:            upstream.URL,
+					AuthType:           config.AuthTypeSigV4,
+					Provider:           config.ProviderBedrock,
+					AWSRegion:          "us-east-1",
+					AWSAccessKeyID:     "AKID",
+					AWSSecretAccessKey: "secret",
+				},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+	for _, want := range []string{"event: message_start", `"stop_reason":"end_turn"`, "event: message_stop"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("stream missing %q: %s", want, out)
+		}
+	}
+}
+
+func TestMessagesVertexProviderServiceAccountAuth(t *testing.T) {
+	var tokenCalls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenCalls.Add(1)
+			_ = r.ParseForm()
+			if r.Form.Get("assertion") == "" {
+				t.Fatalf("missing jwt assertion")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"vertex-token","expires_in":3600}`))
+			return
+		}
+		if r.URL.Path != "/v1/projects/p/locations/us-east5/publishers/anthropic/models/claude-sonnet-4@20250514:rawPredict" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer vertex-token" {
+			t.Fatalf("authorization = %q", got)
+		}
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload["anthropic_version"] != "vertex-2023-10-16" || payload["model"] != nil {
+			t.Fatalf("unexpected body: %v", payload)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	credentialsFile := writeServiceAccountFile(t, upstream.URL+"/token")
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params: config.UpstreamParams{
+					Model:           "claude-sonnet-4@20250514",
+					APIBase:         upstream.URL + "/v1/projects/p/locations/us-east5",
+					AuthType:        config.AuthTypeOAuth,
+					Provider:        config.ProviderVertex,
+					CredentialsFile: credentialsFile,
+				},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+		if err != nil {
+			t.Fatalf("do request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d body=%s", resp.StatusCode, body)
+		}
+	}
+	if got := tokenCalls.Load(); got != 1 {
+		t.Fatalf("token endpoint calls = %d, want 1", got)
+	}
+
+	rotated, err := os.ReadFile(writeServiceAccountFile(t, upstream.URL+"/token"))
+	if err != nil {
+		t.Fatalf("read rotated credentials: %v", err)
+	}
+	if err := os.WriteFile(credentialsFile, rotated, 0o600); err != nil {
+		t.Fatalf("rotate credentials: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(credentialsFile, later, later); err != nil {
+		t.Fatalf("touch credentials: %v", err)
+	}
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after rotation = %d", resp.StatusCode)
+	}
+	if got := tokenCalls.Load(); got != 2 {
+		t.Fatalf("token endpoint calls after rotation = %d, want 2", got)
+	}
+}
+
+func TestOpenAIChatCompletionsNonStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload["model"] != "glm-4.7" || payload["system"] != "be brief" {
+			t.Fatalf("unexpected upstream payload: %v", payload)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"glm-4.7","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":4,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	gw := newGatewayServer(t, upstream.URL)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/openai/v1/chat/completions", "application/json", strings.NewReader(`{"model":"sonnet","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	var out struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if out.Object != "chat.completion" || out.Model != "sonnet" || out.Choices[0].Message.Content != "hello" || out.Choices[0].FinishReason != "stop" || out.Usage.TotalTokens != 5 {
+		t.Fatalf("unexpected response: %+v", out)
+	}
+}
+
+func TestOpenAIChatCompletionsStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":4,\"output_tokens\":0}}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"hel\"}}\n\n"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"lo\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n"))
+		_, _ = w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"max_tokens\"},\"usage\":{\"output_tokens\":2}}\n\n"))
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer upstream.Close()
+
+	gw := newGatewayServer(t, upstream.URL)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/openai/v1/chat/completions", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+	for _, want := range []string{`"object":"chat.completion.chunk"`, `"role":"assistant"`, `"content":"hel"`, `"content":"lo"`, `"finish_reason":"length"`, `"completion_tokens":2`, "data: [DONE]"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("stream missing %s: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "event:") {
+		t.Fatalf("anthropic event names leaked: %s", out)
+	}
+}
+
+func TestOpenAIChatCompletionsUnknownModel(t *testing.T) {
+	gw := newGatewayServer(t, "https://example.com")
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/openai/v1/chat/completions", "application/json", strings.NewReader(`{"model":"unknown","messages":[]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"error":{"message":"unknown model: unknown"`) {
+		t.Fatalf("unexpected error body: %s", string(body))
+	}
+}
+
+func TestOpenAIModels(t *testing.T) {
+	gw := newGatewayServer(t, "https://example.com")
+	defer gw.Close()
+
+	resp, err := http.Get(gw.URL + "/openai/v1/models")
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"object":"list"`) || !strings.Contains(string(body), `"id":"sonnet"`) {
+		t.Fatalf("unexpected models body: %s", string(body))
+	}
+}
+
+func TestVirtualKeysAuthenticateAndAuthorize(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer target-key" {
+			t.Fatalf("authorization = %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	disabled := false
+	params := config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "target-key", AuthType: config.AuthTypeBearer}
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: params},
+			{ModelName: "opus", Params: params},
+		},
+		Keys: []config.VirtualKey{
+			{Name: "alice", Key: "sk-alice", Models: []string{"sonnet"}},
+			{Name: "bob", Key: "sk-bob", Enabled: &disabled},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	cases := []struct {
+		name       string
+		path       string
+		header     string
+		value      string
+		model      string
+		wantStatus int
+		wantType   string
+	}{
+		{"missing key", "/anthropic/v1/messages", "", "", "sonnet", http.StatusUnauthorized, `"type":"authentication_error"`},
+		{"unknown key", "/anthropic/v1/messages", "x-api-key", "sk-nope", "sonnet", http.StatusUnauthorized, `"type":"authentication_error"`},
+		{"disabled key", "/anthropic/v1/messages", "x-api-key", "sk-bob", "sonnet", http.StatusUnauthorized, `"type":"authentication_error"`},
+		{"model not allowed", "/anthropic/v1/messages", "x-api-key", "sk-alice", "opus", http.StatusForbidden, `"type":"permission_error"`},
+		{"allowed model", "/anthropic/v1/messages", "Authorization", "Bearer sk-alice", "sonnet", http.StatusOK, `"type":"message"`},
+		{"openai missing key", "/openai/v1/chat/completions", "", "", "sonnet", http.StatusUnauthorized, `{"error":{"message":"missing API key"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"model":"` + tc.model + `","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+			req, _ := http.NewRequest(http.MethodPost, gw.URL+tc.path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("do request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			respBody, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.wantStatus || !strings.Contains(string(respBody), tc.wantType) {
+				t.Fatalf("status = %d body = %s", resp.StatusCode, respBody)
+			}
+		})
+	}
+
+	resp, err := http.Get(gw.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz should not require a key, got %d", resp.StatusCode)
+	}
+}
+
+func TestRateLimitPerKeyRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("anthropic-ratelimit-requests-limit", "4000")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Keys: []config.VirtualKey{
+			{Name: "alice", Key: "sk-alice", RateLimit: &config.RateLimit{RequestsPerMinute: 2}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	var last *http.Response
+	for i := 0; i < 3; i++ {
+		resp := postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", `{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+		if i == 0 {
+			if got := resp.Header.Get("anthropic-ratelimit-requests-limit"); got != "2" {
+				t.Fatalf("requests-limit = %q", got)
+			}
+			if got := resp.Header.Get("anthropic-ratelimit-requests-remaining"); got != "1" {
+				t.Fatalf("requests-remaining = %q", got)
+			}
+		}
+		last = resp
+	}
+
+	if last.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d", last.StatusCode)
+	}
+	body, _ := io.ReadAll(last.Body)
+	if !strings.Contains(string(body), `"type":"rate_limit_error"`) {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	if last.Header.Get("retry-after") == "" || last.Header.Get("anthropic-ratelimit-requests-remaining") != "0" || last.Header.Get("anthropic-ratelimit-requests-reset") == "" {
+		t.Fatalf("missing rate limit headers: %v", last.Header)
+	}
+}
+
+func TestBudgetRejectsKeyAfterSpend(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1000000,"output_tokens":100000}}`))
+	}))
+	defer upstream.Close()
+
+	spendFile := filepath.Join(t.TempDir(), "spend.json")
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Keys: []config.VirtualKey{
+			{Name: "alice", Key: "sk-alice", Budget: &config.Budget{Daily: 4}},
+		},
+		Pricing: map[string]config.ModelPrice{"glm-4.7": {Input: 3, Output: 15}},
+		Spend:   &config.SpendTracking{File: spendFile},
+		Admin:   &config.Admin{Key: "sk-admin"},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	body := `{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	resp := postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("first status = %d", resp.StatusCode)
+	}
+
+	resp = postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", body)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("second status = %d", resp.StatusCode)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(respBody), "API key alice has exhausted its daily budget of $4.00") {
+		t.Fatalf("unexpected body: %s", respBody)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("upstream hits = %d, want 1", hits.Load())
+	}
+
+	resp = getWithKey(t, gw.URL+"/admin/spend", "sk-admin")
+	var ledger struct {
+		Keys map[string]struct {
+			CostUSD  float64 `json:"cost_usd"`
+			Requests int64   `json:"requests"`
+			Models   map[string]struct {
+				OutputTokens int64 `json:"output_tokens"`
+			} `json:"models"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ledger); err != nil {
+		t.Fatalf("decode spend: %v", err)
+	}
+	alice := ledger.Keys["alice"]
+	if alice.CostUSD != 4.5 || alice.Requests != 1 || alice.Models["sonnet"].OutputTokens != 100000 {
+		t.Fatalf("unexpected spend: %+v", alice)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"busy"}}`))
+	}))
+	defer failing.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n"))
+		_, _ = w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":7}}\n\n"))
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-5", APIBase: failing.URL, APIKey: "k", AuthType: config.AuthTypeBearer}, Fallbacks: []string{"haiku"}},
+			{ModelName: "haiku", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(gw.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Fatalf("content-type = %q", got)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`gateway_requests_total{route="/anthropic/v1/messages",model_name="haiku",upstream_model="glm-4.7",status="200"} 1`,
+		`gateway_request_duration_seconds_count{route="/anthropic/v1/messages",model_name="haiku",upstream_model="glm-4.7",status="200"} 1`,
+		`gateway_stream_time_to_first_byte_seconds_count{route="/anthropic/v1/messages",model_name="haiku",upstream_model="glm-4.7"} 1`,
+		`gateway_upstream_errors_total{model_name="sonnet",upstream_model="glm-5",class="5xx"} 1`,
+		`gateway_input_tokens_total{model_name="haiku",upstream_model="glm-4.7"} 12`,
+		`gateway_output_tokens_total{model_name="haiku",upstream_model="glm-4.7"} 7`,
+		"gateway_requests_in_flight 1",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestTracingContinuesTraceparentUpstream(t *testing.T) {
+	var upstreamTraceparent, upstreamTracestate atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent.Store(r.Header.Get("traceparent"))
+		upstreamTracestate.Store(r.Header.Get("tracestate"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":9,"output_tokens":4}}`))
+	}))
+	defer upstream.Close()
+
+	var (
+		mu    sync.Mutex
+		spans []map[string]any
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]any `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range payload.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Tracing: &config.Tracing{Endpoint: collector.URL, ServiceName: "anthropic-gateway"},
+	}
+	gw, service := newGatewayServerWithService(t, cfg)
+
+	req, _ := http.NewRequest(http.MethodPost, gw.URL+"/anthropic/v1/messages", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-request-id", "req-trace")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	gw.Close()
+	if err := service.Close(); err != nil {
+		t.Fatalf("close service: %v", err)
+	}
+
+	byName := map[string]map[string]any{}
+	mu.Lock()
+	for _, span := range spans {
+		if span["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("span not in incoming trace: %v", span)
+		}
+		byName[span["name"].(string)] = span
+	}
+	mu.Unlock()
+
+	server := byName["POST /anthropic/v1/messages"]
+	attempt := byName["upstream attempt"]
+	if server == nil || attempt == nil || byName["resolve route"] == nil {
+		t.Fatalf("missing spans: %v", byName)
+	}
+	if server["parentSpanId"] != "00f067aa0ba902b7" || attempt["parentSpanId"] != server["spanId"] {
+		t.Fatalf("unexpected span parents: server=%v attempt=%v", server, attempt)
+	}
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + attempt["spanId"].(string) + "-01"; upstreamTraceparent.Load() != want {
+		t.Fatalf("upstream traceparent = %v, want %s", upstreamTraceparent.Load(), want)
+	}
+	if upstreamTracestate.Load() != "vendor=abc" {
+		t.Fatalf("upstream tracestate = %v", upstreamTracestate.Load())
+	}
+
+	attrs := map[string]map[string]any{}
+	for _, attr := range server["attributes"].([]any) {
+		attr := attr.(map[string]any)
+		attrs[attr["key"].(string)] = attr["value"].(map[string]any)
+	}
+	if attrs["request_id"]["stringValue"] != "req-trace" || attrs["gateway.model_name"]["stringValue"] != "sonnet" ||
+		attrs["gen_ai.request.model"]["stringValue"] != "glm-4.7" || attrs["http.response.status_code"]["intValue"] != "200" ||
+		attrs["gen_ai.usage.input_tokens"]["intValue"] != "9" || attrs["gen_ai.usage.output_tokens"]["intValue"] != "4" {
+		t.Fatalf("unexpected server span attributes: %v", attrs)
+	}
+}
+
+func TestReloadSwapsRoutesWithoutDisturbingInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	oldUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_old","type":"message","role":"assistant","content":[]}`))
+	}))
+	defer oldUpstream.Close()
+	newUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_new","type":"message","role":"assistant","content":[]}`))
+	}))
+	defer newUpstream.Close()
+
+	cfg := &config.Config{
+		Listen: config.Listeners{{Address: ":4000"}},
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: oldUpstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	gw, service := newGatewayServerWithService(t, cfg)
+	defer gw.Close()
+
+	body := `{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	inFlight := make(chan string, 1)
+	go func() {
+		resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(body))
+		if err != nil {
+			inFlight <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		inFlight <- string(data)
+	}()
+	<-started
+
+	next := &config.Config{
+		Listen: config.Listeners{{Address: ":5000"}},
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-5", APIBase: newUpstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	if err := next.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	restart, err := service.Reload(next)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(restart) != 1 || restart[0] != "listen" {
+		t.Fatalf("restart = %v", restart)
+	}
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(data), "msg_new") {
+		t.Fatalf("request after reload went to old route: %s", data)
+	}
+
+	close(release)
+	if got := <-inFlight; !strings.Contains(got, "msg_old") {
+		t.Fatalf("in-flight request did not finish on old route: %s", got)
+	}
+}
+
+func TestReloadKeepsConfigWhenTransportIsInvalid(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-5", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	gw, service := newGatewayServerWithService(t, cfg)
+	defer gw.Close()
+
+	next := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-5", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer},
+				Transport: &config.Transport{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+			},
+		},
+	}
+	if err := next.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if _, err := service.Reload(next); err == nil || !strings.Contains(err.Error(), "model sonnet transport") {
+		t.Fatalf("reload err = %v", err)
+	}
+	if service.Config() != cfg {
+		t.Fatalf("config was swapped despite invalid transport")
+	}
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after failed reload = %d", resp.StatusCode)
+	}
+}
+
+func TestAuditLogRecordsStreamedRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5,\"output_tokens\":1}}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\", world\"}}\n\n"))
+		_, _ = w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":3}}\n\n"))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Keys:  []config.VirtualKey{{Name: "alice", Key: "sk-alice"}},
+		Audit: &config.Audit{Dir: dir, MaxSizeMB: 1, IncludeBodies: true},
+	}
+	gw, service := newGatewayServerWithService(t, cfg)
+
+	resp := postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", `{"model":"sonnet","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	_, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	gw.Close()
+	if err := service.Close(); err != nil {
+		t.Fatalf("close service: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	var rec struct {
+		RequestID      string          `json:"request_id"`
+		KeyName        string          `json:"key_name"`
+		RequestedModel string          `json:"requested_model"`
+		ModelName      string          `json:"model_name"`
+		UpstreamModel  string          `json:"upstream_model"`
+		UpstreamURL    string          `json:"upstream_url"`
+		Status         int             `json:"status"`
+		Stream         bool            `json:"stream"`
+		Usage          models.Usage    `json:"usage"`
+		RequestBody    json.RawMessage `json:"request_body"`
+		ResponseText   string          `json:"response_text"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("decode audit record: %v (%s)", err, data)
+	}
+	if rec.RequestID == "" || rec.KeyName != "alice" || rec.RequestedModel != "sonnet" || rec.ModelName != "sonnet" ||
+		rec.UpstreamModel != "glm-4.7" || rec.UpstreamURL != upstream.URL+"/v1/messages" || rec.Status != http.StatusOK || !rec.Stream {
+		t.Fatalf("unexpected audit record: %s", data)
+	}
+	if rec.Usage.InputTokens != 5 || rec.Usage.OutputTokens != 3 || rec.ResponseText != "Hello, world" {
+		t.Fatalf("unexpected usage or text: %s", data)
+	}
+	if !strings.Contains(string(rec.RequestBody), `"content":"hi"`) {
+		t.Fatalf("unexpected request body: %s", rec.RequestBody)
+	}
+}
+
+func TestResponseCacheServesRepeatedRequests(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if got := r.Header.Get("x-gateway-cache"); got != "" {
+			t.Errorf("x-gateway-cache forwarded upstream: %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"cached"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Cache: &config.Cache{TTL: time.Hour, MaxEntries: 10},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	send := func(body string, header http.Header) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, gw.URL+"/anthropic/v1/messages", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	body := `{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	reordered := `{"messages":[{"content":"hi","role":"user"}],"max_tokens":16,"model":"sonnet"}`
+
+	resp, first := send(body, nil)
+	if resp.Header.Get("x-gateway-cache") != "miss" {
+		t.Fatalf("first x-gateway-cache = %q", resp.Header.Get("x-gateway-cache"))
+	}
+	resp, second := send(reordered, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("x-gateway-cache") != "hit" || second != first {
+		t.Fatalf("second response: %d %q %s", resp.StatusCode, resp.Header.Get("x-gateway-cache"), second)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("upstream hits = %d, want 1", hits.Load())
+	}
+
+	resp, _ = send(body, http.Header{"X-Gateway-Cache": {"bypass"}})
+	if resp.Header.Get("x-gateway-cache") != "" || hits.Load() != 2 {
+		t.Fatalf("bypass: header %q, hits %d", resp.Header.Get("x-gateway-cache"), hits.Load())
+	}
+	resp, streamed := send(`{"model":"sonnet","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`, nil)
+	if hits.Load() != 2 || resp.Header.Get("x-gateway-cache") != "hit" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("streaming request: hits %d, cache %q, content-type %q", hits.Load(), resp.Header.Get("x-gateway-cache"), resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(streamed, `"text":"cached"`) || !strings.Contains(streamed, "event: message_stop") {
+		t.Fatalf("unexpected synthesized stream: %s", streamed)
+	}
+
+	resp, err := http.Get(gw.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	metrics, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`gateway_cache_requests_total{model_name="sonnet",result="hit"} 2`,
+		`gateway_cache_requests_total{model_name="sonnet",result="miss"} 1`,
+		`gateway_cache_requests_total{model_name="sonnet",result="bypass"} 1`,
+	} {
+		if !strings.Contains(string(metrics), want) {
+			t.Fatalf("metrics missing %q:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestForceNonStreamingSynthesizesClientStream(t *testing.T) {
+	var upstreamStream atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		upstreamStream.Store(payload["stream"])
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"glm-4.7","content":[{"type":"text","text":"Hello from a buffered upstream"}],"stop_reason":"end_turn","usage":{"input_tokens":6,"output_tokens":5}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer, ForceNonStreaming: true}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if upstreamStream.Load() != false {
+		t.Fatalf("upstream stream = %v, want false", upstreamStream.Load())
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("status = %d, content-type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"event: message_start",
+		"event: content_block_start",
+		`"text_delta","text":"Hello from a buffered upstream"`,
+		`"stop_reason":"end_turn"`,
+		`"output_tokens":5`,
+		"event: message_stop",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("synthesized stream missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestForceStreamingAggregatesUpstreamStream(t *testing.T) {
+	var upstreamStream atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		upstreamStream.Store(payload["stream"])
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"glm-4.7\",\"content\":[],\"usage\":{\"input_tokens\":7,\"output_tokens\":1}}}\n\n"))
+		_, _ = w.Write([]byte("event: ping\ndata: {\"type\":\"ping\"}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Checking \"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"the weather\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"get_weather\",\"input\":{}}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"city\\\":\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\\\"Paris\\\"}\"}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":1}\n\n"))
+		_, _ = w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"},\"usage\":{\"output_tokens\":12}}\n\n"))
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer, ForceStreaming: true}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"weather?"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if upstreamStream.Load() != true {
+		t.Fatalf("upstream stream = %v, want true", upstreamStream.Load())
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Fatalf("status = %d, content-type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var message models.Message
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		t.Fatalf("decode message: %v", err)
+	}
+	if message.ID != "msg_1" || message.StopReason == nil || *message.StopReason != "tool_use" {
+		t.Fatalf("message = %+v", message)
+	}
+	if message.Usage.InputTokens != 7 || message.Usage.OutputTokens != 12 {
+		t.Fatalf("usage = %+v", message.Usage)
+	}
+	if len(message.Content) != 2 || message.Content[0].Text != "Checking the weather" {
+		t.Fatalf("content = %+v", message.Content)
+	}
+	if tool := message.Content[1]; tool.Type != "tool_use" || tool.Name != "get_weather" || string(tool.Input) != `{"city":"Paris"}` {
+		t.Fatalf("tool block = %+v input=%s", tool, tool.Input)
+	}
+}
+
+func TestForceStreamingReturnsUpstreamStreamError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":7}}}\n\n"))
+		_, _ = w.Write([]byte("event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer, ForceStreaming: true}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != 529 {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+	if !strings.Contains(string(body), `"type":"overloaded_error"`) || !strings.Contains(string(body), "Overloaded") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+func TestStreamIdleTimeoutEmitsErrorEvent(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5}}}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Streaming: &config.Streaming{IdleTimeout: 100 * time.Millisecond},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	events := decodeSSEEvents(t, resp.Body)
+
+	if len(events) != 2 || events[0].Name != "message_start" || events[1].Name != "error" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if !strings.Contains(string(events[1].Data), `"type":"overloaded_error"`) || !strings.Contains(string(events[1].Data), "idle") {
+		t.Fatalf("error event = %s", events[1].Data)
+	}
+}
+
+func TestStreamEndingEarlyEmitsErrorEvent(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5}}}\n\n"))
+		_, _ = w.Write([]byte("event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	events := decodeSSEEvents(t, resp.Body)
+
+	last := events[len(events)-1]
+	if len(events) != 3 || last.Name != "error" || !strings.Contains(string(last.Data), `"type":"api_error"`) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestStreamPingsWhileUpstreamIsQuiet(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5}}}\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(250 * time.Millisecond)
+		_, _ = w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":3}}\n\n"))
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Streaming: &config.Streaming{IdleTimeout: time.Second, PingInterval: 50 * time.Millisecond},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	events := decodeSSEEvents(t, resp.Body)
+
+	var names []string
+	pings := 0
+	for _, ev := range events {
+		names = append(names, ev.Name)
+		if ev.Name == "ping" {
+			pings++
+		}
+	}
+	if pings == 0 || names[0] != "message_start" || names[len(names)-1] != "message_stop" {
+		t.Fatalf("events = %v", names)
+	}
+}
+
+func TestRouteResponseHeaderTimeoutIsReported(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer},
+				Transport: &config.Transport{ResponseHeaderTimeout: 100 * time.Millisecond},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+	if !strings.Contains(string(body), "response_header_timeout 100ms") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+func TestRequestTimeoutSkipsStreamingRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		if payload["stream"] == true {
+			_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5}}}\n\n"))
+			_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":5,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Transport: &config.Transport{RequestTimeout: 100 * time.Millisecond},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout || !strings.Contains(string(body), "request_timeout 100ms") {
+		t.Fatalf("non-stream status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	resp, err = http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	events := decodeSSEEvents(t, resp.Body)
+	if resp.StatusCode != http.StatusOK || len(events) != 2 || events[1].Name != "message_stop" {
+		t.Fatalf("stream status = %d, events = %+v", resp.StatusCode, events)
+	}
+}
+
+func TestTransportUsesCAAndClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	clientCA, clientCAKey := newTestCA(t)
+	clientCert := writeTestClientCertificate(t, dir, clientCA, clientCAKey)
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "gateway" {
+			t.Errorf("missing client certificate")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	upstream.Config.ErrorLog = log.New(io.Discard, "", 0)
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	caFile := filepath.Join(dir, "upstream-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("write ca file: %v", err)
+	}
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "internal",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer},
+				Transport: &config.Transport{CAFile: caFile, CertFile: clientCert + ".crt", KeyFile: clientCert + ".key", ServerName: "example.com"},
+			},
+			{
+				ModelName: "no-cert",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer},
+				Transport: &config.Transport{CAFile: caFile},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"internal","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	resp, err = http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"no-cert","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status without client certificate = %d", resp.StatusCode)
+	}
+}
+
+func TestTransportSendsRequestsThroughProxy(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.String() + " " + r.Header.Get("Proxy-Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer proxy.Close()
+
+	proxyURL := strings.Replace(proxy.URL, "http://", "http://user:secret@", 1)
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-4.7", APIBase: "http://upstream.internal", APIKey: "k", AuthType: config.AuthTypeBearer},
+				Transport: &config.Transport{Proxy: proxyURL},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got, want := proxied.Load(), "http://upstream.internal/v1/messages Basic dXNlcjpzZWNyZXQ="; got != want {
+		t.Fatalf("proxied request = %v, want %q", got, want)
+	}
+}
+
+func TestServerListensOnUnixSocketAndReloadsTLSCertificate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket permissions are not enforced on windows")
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeTestServerCertificate(t, certFile, keyFile, 1)
+	socket := filepath.Join(dir, "gateway.sock")
+
+	cfg := &config.Config{
+		Listen: config.Listeners{
+			{Address: "unix://" + socket},
+			{Address: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile},
+		},
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: "http://127.0.0.1:1", APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate config: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service, err := gateway.NewService(cfg, adapter.NewAnthropicCompatibleAdapter(), logger)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	defer service.Close()
+
+	server := httpserver.New(cfg.Listen, logger, service)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = server.Serve() }()
+	defer server.Shutdown(context.Background())
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0o600 {
+		t.Fatalf("socket mode = %o, want 600", got)
+	}
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := unixClient.Get("http://gateway/healthz")
+	if err != nil {
+		t.Fatalf("get over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unix socket status = %d", resp.StatusCode)
+	}
+
+	tlsURL := "https://" + server.Addrs()[1].String() + "/healthz"
+	if got := servedCertificateSerial(t, tlsURL, certFile); got != 1 {
+		t.Fatalf("serial = %d, want 1", got)
+	}
+	writeTestServerCertificate(t, certFile, keyFile, 2)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	_ = os.Chtimes(keyFile, future, future)
+	if got := servedCertificateSerial(t, tlsURL, certFile); got != 2 {
+		t.Fatalf("serial after reload = %d, want 2", got)
+	}
+}
+
+func servedCertificateSerial(t *testing.T, url, caFile string) int64 {
+	t.Helper()
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatalf("read certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(data)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("get over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("TLS status = %d", resp.StatusCode)
+	}
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+}
+
+func writeTestServerCertificate(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "gateway"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create server certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write server key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write server certificate: %v", err)
+	}
+}
+
+func newTestCA(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA: %v", err)
+	}
+	return cert, key
+}
+
+func writeTestClientCertificate(t *testing.T, dir string, ca *x509.Certificate, caKey *rsa.PrivateKey) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "gateway"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create client certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	base := filepath.Join(dir, "client")
+	if err := os.WriteFile(base+".crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write client certificate: %v", err)
+	}
+	if err := os.WriteFile(base+".key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write client key: %v", err)
+	}
+	return base
+}
+
+func TestDrainRejectsNewRequestsAndClosesOpenStreams(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5}}}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	gw, service := newGatewayServerWithService(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	stream := sse.NewReader(resp.Body)
+	if ev, err := stream.Next(); err != nil || ev.Name != "message_start" {
+		t.Fatalf("first event = %+v, err = %v", ev, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	drained := make(chan int, 1)
+	go func() { drained <- service.Drain(ctx) }()
+	for !service.Draining() {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	health, err := http.Get(gw.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("healthz: %v", err)
+	}
+	healthBody, _ := io.ReadAll(health.Body)
+	health.Body.Close()
+	if health.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(healthBody), "draining") {
+		t.Fatalf("healthz status = %d, body = %s", health.StatusCode, healthBody)
+	}
+
+	rejected, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post during drain: %v", err)
+	}
+	rejectedBody, _ := io.ReadAll(rejected.Body)
+	rejected.Body.Close()
+	if rejected.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(rejectedBody), `"type":"overloaded_error"`) {
+		t.Fatalf("status during drain = %d, body = %s", rejected.StatusCode, rejectedBody)
+	}
+
+	if open := <-drained; open != 1 {
+		t.Fatalf("open streams at drain deadline = %d, want 1", open)
+	}
+	ev, err := stream.Next()
+	if err != nil || ev.Name != "error" || !strings.Contains(string(ev.Data), "shutting down") {
+		t.Fatalf("final event = %s %s, err = %v", ev.Name, ev.Data, err)
+	}
+}
+
+func decodeSSEEvents(t *testing.T, body io.Reader) []sse.Event {
+	t.Helper()
+
+	reader := sse.NewReader(body)
+	var events []sse.Event
+	for {
+		ev, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestRateLimitReconcilesStreamedOutputTokens(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5,\"output_tokens\":1}}}\n\n"))
+		_, _ = w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":50}}\n\n"))
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Keys: []config.VirtualKey{
+			{Name: "alice", Key: "sk-alice", RateLimit: &config.RateLimit{OutputTokensPerMinute: 20}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	first := postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", `{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+	_, _ = io.ReadAll(first.Body)
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first status = %d", first.StatusCode)
+	}
+
+	second := postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", `{"model":"sonnet","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second status = %d", second.StatusCode)
+	}
+	if got := second.Header.Get("anthropic-ratelimit-output-tokens-remaining"); got != "0" {
+		t.Fatalf("output-tokens-remaining = %q", got)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("upstream hits = %d, want 1", got)
+	}
+}
+
+func TestRateLimitedDeploymentIsSkipped(t *testing.T) {
+	var firstHits, secondHits atomic.Int32
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		firstHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer first.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_2","type":"message","role":"assistant","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer second.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Deployments: []config.UpstreamParams{
+					{Model: "a", APIBase: first.URL, APIKey: "k", AuthType: config.AuthTypeBearer, Weight: 100, RateLimit: &config.RateLimit{RequestsPerMinute: 1}},
+					{Model: "b", APIBase: second.URL, APIKey: "k", AuthType: config.AuthTypeBearer, Weight: 1, RateLimit: &config.RateLimit{RequestsPerMinute: 1}},
+				},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	statuses := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+		if err != nil {
+			t.Fatalf("do request: %v", err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+		if i == 2 && resp.Header.Get("retry-after") == "" {
+			t.Fatalf("missing retry-after on exhausted deployments")
+		}
+	}
+
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusOK || statuses[2] != http.StatusTooManyRequests {
+		t.Fatalf("statuses = %v", statuses)
+	}
+	if firstHits.Load() != 1 || secondHits.Load() != 1 {
+		t.Fatalf("hits = %d/%d, want 1/1", firstHits.Load(), secondHits.Load())
+	}
+}
+
+func postWithKey(t *testing.T, url, key, body string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestOpenAIStreamPingsWhileUpstreamIsQuiet(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":5}}}\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(250 * time.Millisecond)
+		_, _ = w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":3}}\n\n"))
+		_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Streaming: &config.Streaming{IdleTimeout: time.Second, PingInterval: 50 * time.Millisecond},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/openai/v1/chat/completions", "application/json", strings.NewReader(`{"model":"sonnet","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), ": ping\n\n") || !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Fatalf("body = %s", body)
+	}
+}
+
+func TestResponseCacheHitsCountAgainstKeyRateLimit(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"cached"}],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Keys:  []config.VirtualKey{{Name: "alice", Key: "sk-alice", RateLimit: &config.RateLimit{RequestsPerMinute: 2}}},
+		Cache: &config.Cache{TTL: time.Hour, MaxEntries: 10},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	body := `{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`
+	resp := postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("x-gateway-cache") != "miss" {
+		t.Fatalf("first: %d %q", resp.StatusCode, resp.Header.Get("x-gateway-cache"))
+	}
+	resp = postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("x-gateway-cache") != "hit" || resp.Header.Get("anthropic-ratelimit-requests-remaining") != "0" {
+		t.Fatalf("second: %d %q remaining %q", resp.StatusCode, resp.Header.Get("x-gateway-cache"), resp.Header.Get("anthropic-ratelimit-requests-remaining"))
+	}
+	resp = postWithKey(t, gw.URL+"/anthropic/v1/messages", "sk-alice", body)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("third status = %d, want 429", resp.StatusCode)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("upstream hits = %d, want 1", hits.Load())
+	}
+}
+
+func TestAdminEndpointsRequireAdminKey(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: "http://127.0.0.1:1", APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Keys:  []config.VirtualKey{{Name: "alice", Key: "sk-alice"}},
+		Admin: &config.Admin{Key: "sk-admin"},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	for _, tc := range []struct {
+		path string
+		key  string
+		want int
+	}{
+		{"/admin/spend", "", http.StatusUnauthorized},
+		{"/admin/spend", "sk-alice", http.StatusUnauthorized},
+		{"/admin/spend", "sk-admin", http.StatusOK},
+		{"/admin/circuits", "sk-alice", http.StatusUnauthorized},
+		{"/admin/circuits", "sk-admin", http.StatusOK},
+		{"/healthz", "", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, gw.URL+tc.path, nil)
+		if tc.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get %s: %v", tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Fatalf("%s with key %q status = %d, want %d", tc.path, tc.key, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestAdminEndpointsRejectedWithoutAdminKey(t *testing.T) {
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{ModelName: "sonnet", Params: config.UpstreamParams{Model: "glm-4.7", APIBase: "http://127.0.0.1:1", APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+		Keys: []config.VirtualKey{{Name: "alice", Key: "sk-alice"}},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	for _, path := range []string{"/admin/spend", "/admin/circuits"} {
+		resp := getWithKey(t, gw.URL+path, "sk-alice")
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "authentication_error") {
+			t.Fatalf("%s status = %d body=%s", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestMessagesFailsOverWhenDeploymentCannotBeAuthorized(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer tokenServer.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params: config.UpstreamParams{
+					Model:           "claude-sonnet-4@20250514",
+					APIBase:         tokenServer.URL + "/v1/projects/p/locations/us-east5",
+					AuthType:        config.AuthTypeOAuth,
+					Provider:        config.ProviderVertex,
+					CredentialsFile: writeServiceAccountFile(t, tokenServer.URL+"/token"),
+				},
+				Fallbacks: []string{"backup"},
+			},
+			{ModelName: "backup", Params: config.UpstreamParams{Model: "glm-5", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer}},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d body=%s", resp.StatusCode, body)
+	}
+
+	cfg.ModelList[0].Fallbacks = nil
+	gw2 := newGatewayServerWithConfig(t, cfg)
+	defer gw2.Close()
+
+	resp, err = http.Post(gw2.URL+"/anthropic/v1/messages", "application/json", strings.NewReader(`{"model":"sonnet","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "failed to authorize upstream request") {
+		t.Fatalf("status = %d body=%s", resp.StatusCode, body)
+	}
+}
+
+func writeServiceAccountFile(t *testing.T, tokenURI string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "gateway@p.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+	credentialsFile := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(credentialsFile, credentials, 0o600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+	return credentialsFile
+}
+
+func TestCountTokensKeepsPrimaryFailureWhenFallbackCannotServePath(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"primary overloaded"}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Retry: &config.RetryPolicy{MaxAttempts: 1},
+		ModelList: []config.ModelRoute{
+			{
+				ModelName: "sonnet",
+				Params:    config.UpstreamParams{Model: "glm-5", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer},
+				Fallbacks: []string{"local"},
+			},
+			{
+				ModelName: "local",
+				Params:    config.UpstreamParams{Model: "qwen3", APIBase: upstream.URL, APIKey: "k", AuthType: config.AuthTypeBearer, Provider: config.ProviderOpenAI},
+			},
+		},
+	}
+	gw := newGatewayServerWithConfig(t, cfg)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/anthropic/v1/messages/count_tokens", "application/json", strings.NewReader(`{"model":"sonnet","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "primary overloaded") {
+		t.Fatalf("status = %d body=%s", resp.StatusCode, body)
+	}
+}
+
+func getWithKey(t *testing.T, url, key string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if key != "" {
+		req.Header.Set("x-api-key", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
 func newGatewayServer(t *testing.T, upstreamURL string) *httptest.Server {
 	t.Helper()
 
 	cfg := &config.Config{
-		Listen: ":0",
+		Listen: config.Listeners{{Address: ":0"}},
 		ModelList: []config.ModelRoute{
 			{
 				ModelName: "sonnet",
@@ -288,12 +2651,28 @@ func newGatewayServer(t *testing.T, upstreamURL string) *httptest.Server {
 			},
 		},
 	}
+	return newGatewayServerWithConfig(t, cfg)
+}
+
+func newGatewayServerWithConfig(t *testing.T, cfg *config.Config) *httptest.Server {
+	t.Helper()
+	gw, _ := newGatewayServerWithService(t, cfg)
+	return gw
+}
+
+func newGatewayServerWithService(t *testing.T, cfg *config.Config) (*httptest.Server, *gateway.Service) {
+	t.Helper()
+
 	if err := cfg.Validate(); err != nil {
 		t.Fatalf("validate config: %v", err)
 	}
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	service := gateway.NewService(cfg, adapter.NewAnthropicCompatibleAdapter(), logger)
+	service, err := gateway.NewService(cfg, adapter.NewAnthropicCompatibleAdapter(), logger)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	t.Cleanup(func() { _ = service.Close() })
 	handler := httpserver.NewHandler(logger, service)
-	return httptest.NewServer(handler)
+	return httptest.NewServer(handler), service
 }
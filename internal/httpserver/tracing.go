@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"anthropic-gateway/internal/tracing"
+)
+
+func withTracing(next http.Handler, mux *http.ServeMux, tracer *tracing.Tracer) http.Handler {
+	if tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracer.Start(ctx, r.Method+" "+route, tracing.KindServer)
+		defer span.End()
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("request_id", w.Header().Get("x-request-id"))
+
+		rw := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttr("http.response.status_code", rw.statusCode)
+		if rw.statusCode >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(rw.statusCode))
+		}
+	})
+}
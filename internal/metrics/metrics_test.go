@@ -0,0 +1,70 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/metrics"
+)
+
+func TestWriteTextExposition(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.Counter("requests_total", "Requests served.", "route", "status")
+	inFlight := registry.Gauge("in_flight", "In-flight requests.")
+	latency := registry.Histogram("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+
+	requests.Inc("/a", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc(`/b"\`+"\n", "500")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(2, "/a")
+
+	var b strings.Builder
+	if err := registry.WriteText(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	want := `# HELP in_flight In-flight requests.
+# TYPE in_flight gauge
+in_flight 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 2.55
+latency_seconds_count{route="/a"} 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a",status="200"} 3
+requests_total{route="/b\"\\\n",status="500"} 1
+`
+	if b.String() != want {
+		t.Fatalf("unexpected exposition:\n%s", b.String())
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.Counter("hits_total", "Hits.").Inc()
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("status = %d, content-type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "hits_total 1\n") {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status = %d", rec.Code)
+	}
+}
@@ -42,3 +42,29 @@ func BuildListResponse(cfg *config.Config) ListResponse {
 	}
 	return resp
 }
+
+type OpenAIListResponse struct {
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func BuildOpenAIListResponse(cfg *config.Config) OpenAIListResponse {
+	items := make([]OpenAIModel, 0, len(cfg.ModelList))
+	created := time.Now().Unix()
+	for _, route := range cfg.ModelList {
+		items = append(items, OpenAIModel{
+			ID:      route.ModelName,
+			Object:  "model",
+			Created: created,
+			OwnedBy: "anthropic-gateway",
+		})
+	}
+	return OpenAIListResponse{Object: "list", Data: items}
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"encoding/json"
+
+	apierrors "anthropic-gateway/internal/errors"
+)
+
+const (
+	EventMessageStart      = "message_start"
+	EventContentBlockStart = "content_block_start"
+	EventContentBlockDelta = "content_block_delta"
+	EventContentBlockStop  = "content_block_stop"
+	EventMessageDelta      = "message_delta"
+	EventMessageStop       = "message_stop"
+	EventPing              = "ping"
+	EventError             = "error"
+)
+
+type StreamEvent struct {
+	Type         string           `json:"type"`
+	Message      *Message         `json:"message,omitempty"`
+	Index        int              `json:"index"`
+	ContentBlock *ContentBlock    `json:"content_block,omitempty"`
+	Delta        *StreamDelta     `json:"delta,omitempty"`
+	Usage        *Usage           `json:"usage,omitempty"`
+	Error        *apierrors.Inner `json:"error,omitempty"`
+}
+
+type StreamDelta struct {
+	Type         string  `json:"type,omitempty"`
+	Text         string  `json:"text,omitempty"`
+	PartialJSON  string  `json:"partial_json,omitempty"`
+	Thinking     string  `json:"thinking,omitempty"`
+	Signature    string  `json:"signature,omitempty"`
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+func (e StreamEvent) MarshalJSON() ([]byte, error) {
+	switch e.Type {
+	case EventContentBlockStart:
+		return json.Marshal(struct {
+			Type         string        `json:"type"`
+			Index        int           `json:"index"`
+			ContentBlock *ContentBlock `json:"content_block"`
+		}{e.Type, e.Index, e.ContentBlock})
+	case EventContentBlockDelta:
+		return json.Marshal(struct {
+			Type  string       `json:"type"`
+			Index int          `json:"index"`
+			Delta *StreamDelta `json:"delta"`
+		}{e.Type, e.Index, e.Delta})
+	case EventContentBlockStop:
+		return json.Marshal(struct {
+			Type  string `json:"type"`
+			Index int    `json:"index"`
+		}{e.Type, e.Index})
+	case EventMessageDelta:
+		delta := e.Delta
+		if delta == nil {
+			delta = &StreamDelta{}
+		}
+		return json.Marshal(struct {
+			Type  string `json:"type"`
+			Delta struct {
+				StopReason   *string `json:"stop_reason"`
+				StopSequence *string `json:"stop_sequence"`
+			} `json:"delta"`
+			Usage *Usage `json:"usage,omitempty"`
+		}{
+			Type: e.Type,
+			Delta: struct {
+				StopReason   *string `json:"stop_reason"`
+				StopSequence *string `json:"stop_sequence"`
+			}{delta.StopReason, delta.StopSequence},
+			Usage: e.Usage,
+		})
+	default:
+		return json.Marshal(struct {
+			Type    string           `json:"type"`
+			Message *Message         `json:"message,omitempty"`
+			Error   *apierrors.Inner `json:"error,omitempty"`
+		}{e.Type, e.Message, e.Error})
+	}
+}
+
+func MergeUsage(dst *Usage, src Usage) {
+	if src.InputTokens > 0 {
+		dst.InputTokens = src.InputTokens
+	}
+	if src.OutputTokens > 0 {
+		dst.OutputTokens = src.OutputTokens
+	}
+	if src.CacheCreationInputTokens > 0 {
+		dst.CacheCreationInputTokens = src.CacheCreationInputTokens
+	}
+	if src.CacheReadInputTokens > 0 {
+		dst.CacheReadInputTokens = src.CacheReadInputTokens
+	}
+}
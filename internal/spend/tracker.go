@@ -0,0 +1,254 @@
+package spend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/models"
+)
+
+const (
+	dayLayout      = "2006-01-02"
+	monthLayout    = "2006-01"
+	dailyRetention = 62 * 24 * time.Hour
+	flushInterval  = 2 * time.Second
+)
+
+type Totals struct {
+	CostUSD          float64            `json:"cost_usd"`
+	Requests         int64              `json:"requests"`
+	InputTokens      int64              `json:"input_tokens"`
+	OutputTokens     int64              `json:"output_tokens"`
+	CacheWriteTokens int64              `json:"cache_write_tokens"`
+	CacheReadTokens  int64              `json:"cache_read_tokens"`
+	Daily            map[string]float64 `json:"daily_usd"`
+	Monthly          map[string]float64 `json:"monthly_usd"`
+}
+
+type KeyTotals struct {
+	Totals
+	Models map[string]*Totals `json:"models"`
+}
+
+type Ledger struct {
+	Keys   map[string]*KeyTotals `json:"keys"`
+	Models map[string]*Totals    `json:"models"`
+}
+
+type Tracker struct {
+	mu     sync.Mutex
+	path   string
+	ledger Ledger
+	dirty  bool
+	logger *slog.Logger
+	now    func() time.Time
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func Open(path string, logger *slog.Logger) (*Tracker, error) {
+	t := &Tracker{
+		path:   path,
+		logger: logger,
+		ledger: Ledger{Keys: make(map[string]*KeyTotals), Models: make(map[string]*Totals)},
+		now:    time.Now,
+		done:   make(chan struct{}),
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read spend file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &t.ledger); err != nil {
+			return nil, fmt.Errorf("decode spend file: %w", err)
+		}
+		if t.ledger.Keys == nil {
+			t.ledger.Keys = make(map[string]*KeyTotals)
+		}
+		if t.ledger.Models == nil {
+			t.ledger.Models = make(map[string]*Totals)
+		}
+	}
+
+	t.wg.Add(1)
+	go t.flushLoop()
+	return t, nil
+}
+
+func Cost(price config.ModelPrice, usage models.Usage) float64 {
+	return (float64(usage.InputTokens)*price.Input +
+		float64(usage.OutputTokens)*price.Output +
+		float64(usage.CacheCreationInputTokens)*price.CacheWrite +
+		float64(usage.CacheReadInputTokens)*price.CacheRead) / 1e6
+}
+
+func (t *Tracker) Record(keyName, modelName string, usage models.Usage, cost float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	model := t.ledger.Models[modelName]
+	if model == nil {
+		model = &Totals{}
+		t.ledger.Models[modelName] = model
+	}
+	model.add(now, usage, cost)
+
+	if keyName != "" {
+		key := t.ledger.Keys[keyName]
+		if key == nil {
+			key = &KeyTotals{}
+			t.ledger.Keys[keyName] = key
+		}
+		if key.Models == nil {
+			key.Models = make(map[string]*Totals)
+		}
+		key.add(now, usage, cost)
+		keyModel := key.Models[modelName]
+		if keyModel == nil {
+			keyModel = &Totals{}
+			key.Models[modelName] = keyModel
+		}
+		keyModel.add(now, usage, cost)
+	}
+	t.dirty = true
+}
+
+func (t *Tracker) BudgetExceeded(keyName string, budget *config.Budget) (string, float64, bool) {
+	if budget == nil {
+		return "", 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := t.ledger.Keys[keyName]
+	if key == nil {
+		return "", 0, false
+	}
+	now := t.now().UTC()
+	if budget.Daily > 0 && key.Daily[now.Format(dayLayout)] >= budget.Daily {
+		return "daily", budget.Daily, true
+	}
+	if budget.Monthly > 0 && key.Monthly[now.Format(monthLayout)] >= budget.Monthly {
+		return "monthly", budget.Monthly, true
+	}
+	return "", 0, false
+}
+
+func (t *Tracker) Snapshot() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return json.Marshal(t.ledger)
+}
+
+func (t *Tracker) Close() error {
+	if t.path == "" {
+		return nil
+	}
+	select {
+	case <-t.done:
+		return nil
+	default:
+		close(t.done)
+	}
+	t.wg.Wait()
+	return t.flush()
+}
+
+func (t *Tracker) flushLoop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if err := t.flush(); err != nil {
+				t.logger.Error("failed to persist spend", "error", err, "path", t.path)
+			}
+		}
+	}
+}
+
+func (t *Tracker) flush() error {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(t.ledger, "", "  ")
+	t.dirty = false
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode spend file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".tmp-*")
+	if err != nil {
+		t.markDirty()
+		return fmt.Errorf("write spend file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		t.markDirty()
+		return fmt.Errorf("write spend file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		t.markDirty()
+		return fmt.Errorf("write spend file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		os.Remove(tmp.Name())
+		t.markDirty()
+		return fmt.Errorf("write spend file: %w", err)
+	}
+	return nil
+}
+
+func (t *Tracker) markDirty() {
+	t.mu.Lock()
+	t.dirty = true
+	t.mu.Unlock()
+}
+
+func (tot *Totals) add(now time.Time, usage models.Usage, cost float64) {
+	if tot.Daily == nil {
+		tot.Daily = make(map[string]float64)
+	}
+	if tot.Monthly == nil {
+		tot.Monthly = make(map[string]float64)
+	}
+	tot.CostUSD += cost
+	tot.Requests++
+	tot.InputTokens += int64(usage.InputTokens)
+	tot.OutputTokens += int64(usage.OutputTokens)
+	tot.CacheWriteTokens += int64(usage.CacheCreationInputTokens)
+	tot.CacheReadTokens += int64(usage.CacheReadInputTokens)
+	tot.Daily[now.Format(dayLayout)] += cost
+	tot.Monthly[now.Format(monthLayout)] += cost
+
+	cutoff := now.Add(-dailyRetention).Format(dayLayout)
+	for day := range tot.Daily {
+		if day < cutoff {
+			delete(tot.Daily, day)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package spend_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/models"
+	"anthropic-gateway/internal/spend"
+)
+
+func TestCost(t *testing.T) {
+	price := config.ModelPrice{Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3}
+	usage := models.Usage{InputTokens: 1000, OutputTokens: 2000, CacheCreationInputTokens: 4000, CacheReadInputTokens: 10000}
+
+	got := spend.Cost(price, usage)
+	want := (1000*3 + 2000*15 + 4000*3.75 + 10000*0.3) / 1e6
+	if math.Abs(got-want) > 1e-12 {
+		t.Fatalf("cost = %v, want %v", got, want)
+	}
+}
+
+func TestTrackerPersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spend.json")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tracker, err := spend.Open(path, logger)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	tracker.Record("alice", "sonnet", models.Usage{InputTokens: 10, OutputTokens: 5}, 1.5)
+	tracker.Record("alice", "haiku", models.Usage{InputTokens: 1}, 0.5)
+	tracker.Record("", "sonnet", models.Usage{InputTokens: 2}, 0.25)
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := spend.Open(path, logger)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+
+	data, err := reopened.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	var ledger spend.Ledger
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	alice := ledger.Keys["alice"]
+	if alice == nil || alice.CostUSD != 2 || alice.Requests != 2 || alice.InputTokens != 11 {
+		t.Fatalf("unexpected key totals: %+v", alice)
+	}
+	if got := alice.Models["sonnet"]; got == nil || got.CostUSD != 1.5 || got.OutputTokens != 5 {
+		t.Fatalf("unexpected key model totals: %+v", got)
+	}
+	if got := ledger.Models["sonnet"]; got == nil || got.CostUSD != 1.75 || got.Requests != 2 {
+		t.Fatalf("unexpected model totals: %+v", got)
+	}
+	if len(alice.Daily) != 1 || len(alice.Monthly) != 1 {
+		t.Fatalf("unexpected periods: daily=%v monthly=%v", alice.Daily, alice.Monthly)
+	}
+
+	if _, _, exceeded := reopened.BudgetExceeded("alice", &config.Budget{Monthly: 3}); exceeded {
+		t.Fatalf("monthly budget of 3 should not be exceeded")
+	}
+	period, limit, exceeded := reopened.BudgetExceeded("alice", &config.Budget{Daily: 2, Monthly: 100})
+	if !exceeded || period != "daily" || limit != 2 {
+		t.Fatalf("BudgetExceeded = %q %v %v", period, limit, exceeded)
+	}
+}
+
+func TestTrackerRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spend.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := spend.Open(path, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Fatalf("expected error for corrupt spend file")
+	}
+}
@@ -0,0 +1,95 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+type Event struct {
+	Name string
+	Data []byte
+}
+
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 16*1024)}
+}
+
+func (r *Reader) Next() (Event, error) {
+	var event Event
+	var data [][]byte
+	pending := false
+
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if errors.Is(err, io.EOF) && pending {
+				event.Data = bytes.Join(data, []byte("\n"))
+				return event, nil
+			}
+			return Event{}, err
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if pending {
+				event.Data = bytes.Join(data, []byte("\n"))
+				return event, nil
+			}
+			if err != nil {
+				return Event{}, err
+			}
+			continue
+		}
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(field) {
+		case "event":
+			event.Name = string(value)
+			pending = true
+		case "data":
+			data = append(data, append([]byte(nil), value...))
+			pending = true
+		}
+
+		if err != nil {
+			event.Data = bytes.Join(data, []byte("\n"))
+			return event, nil
+		}
+	}
+}
+
+func Encode(name string, data []byte) []byte {
+	var buf bytes.Buffer
+	if name != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		buf.WriteString("data: ")
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func EncodeJSON(name string, v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Encode(name, data), nil
+}
@@ -0,0 +1,45 @@
+package sse_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"anthropic-gateway/internal/sse"
+)
+
+func TestReaderParsesEvents(t *testing.T) {
+	stream := ": comment\n" +
+		"event: message_start\r\n" +
+		"data: {\"a\":1}\r\n\r\n" +
+		"data: line1\n" +
+		"data: line2\n\n" +
+		"data: [DONE]"
+
+	r := sse.NewReader(strings.NewReader(stream))
+
+	ev, err := r.Next()
+	if err != nil || ev.Name != "message_start" || string(ev.Data) != `{"a":1}` {
+		t.Fatalf("first event = %+v, err=%v", ev, err)
+	}
+	ev, err = r.Next()
+	if err != nil || ev.Name != "" || string(ev.Data) != "line1\nline2" {
+		t.Fatalf("second event = %+v, err=%v", ev, err)
+	}
+	ev, err = r.Next()
+	if err != nil || string(ev.Data) != "[DONE]" {
+		t.Fatalf("trailing event = %+v, err=%v", ev, err)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	got := string(sse.Encode("ping", []byte(`{"type":"ping"}`)))
+	want := "event: ping\ndata: {\"type\":\"ping\"}\n\n"
+	if got != want {
+		t.Fatalf("encode = %q, want %q", got, want)
+	}
+}
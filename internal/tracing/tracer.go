@@ -0,0 +1,347 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"anthropic-gateway/internal/config"
+)
+
+const (
+	exportInterval  = 5 * time.Second
+	exportTimeout   = 10 * time.Second
+	maxExportBatch  = 512
+	maxPendingSpans = 4096
+)
+
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type Tracer struct {
+	url         string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+	logger      *slog.Logger
+
+	mu      sync.Mutex
+	pending []*Span
+	dropped int
+
+	flush     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type Span struct {
+	tracer   *Tracer
+	sc       SpanContext
+	parentID SpanID
+	name     string
+	kind     SpanKind
+
+	mu         sync.Mutex
+	start      time.Time
+	end        time.Time
+	attributes []attribute
+	errMessage string
+	failed     bool
+	ended      bool
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+func New(cfg *config.Tracing, logger *slog.Logger) *Tracer {
+	if cfg == nil {
+		return nil
+	}
+	t := &Tracer{
+		url:         cfg.TracesURL(),
+		serviceName: cfg.ServiceName,
+		headers:     cfg.Headers,
+		client:      &http.Client{Timeout: exportTimeout},
+		logger:      logger,
+		flush:       make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.exportLoop()
+	return t
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := parentFromContext(ctx)
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	span.sc.SpanID = newSpanID()
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Flags = parent.Flags
+		span.sc.TraceState = parent.TraceState
+		span.parentID = parent.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Flags = flagSampled
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.closeOnce.Do(func() { close(t.done) })
+	t.wg.Wait()
+	return t.export()
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.errMessage = message
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled() {
+		s.tracer.enqueue(s)
+	}
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.Lock()
+	if len(t.pending) >= maxPendingSpans {
+		t.dropped++
+		t.mu.Unlock()
+		return
+	}
+	t.pending = append(t.pending, s)
+	full := len(t.pending) >= maxExportBatch
+	t.mu.Unlock()
+
+	if full {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) exportLoop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		case <-t.flush:
+		}
+		if err := t.export(); err != nil {
+			t.logger.Warn("failed to export traces", "error", err, "endpoint", t.url)
+		}
+	}
+}
+
+func (t *Tracer) export() error {
+	t.mu.Lock()
+	spans := t.pending
+	dropped := t.dropped
+	t.pending = nil
+	t.dropped = 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		t.logger.Warn("dropped spans, export queue full", "dropped", dropped)
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), maxExportBatch)
+		if err := t.send(spans[:n]); err != nil {
+			return err
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+func (t *Tracer) send(spans []*Span) error {
+	body, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return fmt.Errorf("encode spans: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func (t *Tracer) encode(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			TraceState:        s.sc.TraceState,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != (SpanID{}) {
+			span.ParentSpanID = s.parentID.String()
+		}
+		for _, attr := range s.attributes {
+			span.Attributes = append(span.Attributes, encodeAttribute(attr.key, attr.value))
+		}
+		if s.failed {
+			span.Status = &otlpStatus{Code: 2, Message: s.errMessage}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{encodeAttribute("service.name", t.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "anthropic-gateway"}, Spans: out}},
+	}}}
+}
+
+func encodeAttribute(key string, value any) otlpAttribute {
+	var v map[string]any
+	switch value := value.(type) {
+	case string:
+		v = map[string]any{"stringValue": value}
+	case bool:
+		v = map[string]any{"boolValue": value}
+	case int:
+		v = map[string]any{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": value}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(value)}
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
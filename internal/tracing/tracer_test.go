@@ -0,0 +1,152 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"anthropic-gateway/internal/config"
+	"anthropic-gateway/internal/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok {
+		t.Fatalf("expected valid traceparent")
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled() {
+		t.Fatalf("unexpected span context: %+v", sc)
+	}
+	if got := sc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("traceparent = %q", got)
+	}
+
+	for _, value := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, ok := tracing.ParseTraceparent(value); ok {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestTracerContinuesRemoteTraceAndExports(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []map[string]any
+		headers  http.Header
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("collector path = %s", r.URL.Path)
+		}
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		payloads = append(payloads, payload)
+		headers = r.Header.Clone()
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	tracer := tracing.New(&config.Tracing{Endpoint: collector.URL, ServiceName: "gw", Headers: map[string]string{"x-collector-token": "secret"}}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Set("tracestate", "vendor=abc")
+	ctx := tracing.Extract(context.Background(), in)
+
+	ctx, server := tracer.Start(ctx, "POST /v1/messages", tracing.KindServer)
+	server.SetAttr("request_id", "req-1")
+	server.SetAttr("gen_ai.usage.input_tokens", 12)
+	childCtx, child := tracer.Start(ctx, "upstream attempt", tracing.KindClient)
+
+	out := http.Header{}
+	tracing.Inject(childCtx, out)
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + child.Context().SpanID.String() + "-01"; out.Get("traceparent") != want {
+		t.Fatalf("traceparent = %q, want %q", out.Get("traceparent"), want)
+	}
+	if out.Get("tracestate") != "vendor=abc" {
+		t.Fatalf("tracestate = %q", out.Get("tracestate"))
+	}
+
+	child.SetError("503 Service Unavailable")
+	child.End()
+	server.End()
+	if err := tracer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(payloads) != 1 {
+		t.Fatalf("exports = %d", len(payloads))
+	}
+	if headers.Get("x-collector-token") != "secret" || headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected export headers: %v", headers)
+	}
+
+	resource := payloads[0]["resourceSpans"].([]any)[0].(map[string]any)
+	serviceName := resource["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	if serviceName["key"] != "service.name" || serviceName["value"].(map[string]any)["stringValue"] != "gw" {
+		t.Fatalf("unexpected resource: %v", resource["resource"])
+	}
+	spans := resource["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d", len(spans))
+	}
+	clientSpan := spans[0].(map[string]any)
+	serverSpan := spans[1].(map[string]any)
+	if serverSpan["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || serverSpan["parentSpanId"] != "00f067aa0ba902b7" || serverSpan["kind"] != float64(2) {
+		t.Fatalf("unexpected server span: %v", serverSpan)
+	}
+	if clientSpan["parentSpanId"] != serverSpan["spanId"] || clientSpan["kind"] != float64(3) {
+		t.Fatalf("unexpected client span: %v", clientSpan)
+	}
+	if status := clientSpan["status"].(map[string]any); status["code"] != float64(2) || status["message"] != "503 Service Unavailable" {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	attrs := serverSpan["attributes"].([]any)
+	tokens := attrs[1].(map[string]any)
+	if tokens["key"] != "gen_ai.usage.input_tokens" || tokens["value"].(map[string]any)["intValue"] != "12" {
+		t.Fatalf("unexpected attributes: %v", attrs)
+	}
+}
+
+func TestUnsampledParentIsPropagatedButNotExported(t *testing.T) {
+	var exported atomic.Bool
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exported.Store(true)
+	}))
+	defer collector.Close()
+
+	tracer := tracing.New(&config.Tracing{Endpoint: collector.URL + "/v1/traces"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), in), "request", tracing.KindServer)
+
+	out := http.Header{}
+	tracing.Inject(ctx, out)
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.Context().SpanID.String() + "-00"; out.Get("traceparent") != want {
+		t.Fatalf("traceparent = %q, want %q", out.Get("traceparent"), want)
+	}
+	span.End()
+	if err := tracer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if exported.Load() {
+		t.Fatalf("unsampled span was exported")
+	}
+}